@@ -1,16 +1,39 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/FacelessWayfarer/urlshortner/internal/alias"
+	"github.com/FacelessWayfarer/urlshortner/internal/clicks"
 	"github.com/FacelessWayfarer/urlshortner/internal/config"
+	"github.com/FacelessWayfarer/urlshortner/internal/database"
+	"github.com/FacelessWayfarer/urlshortner/internal/database/memory"
+	"github.com/FacelessWayfarer/urlshortner/internal/database/postgres"
 	"github.com/FacelessWayfarer/urlshortner/internal/database/sqllite"
+	urlbulk "github.com/FacelessWayfarer/urlshortner/internal/handlers/url-bulk"
 	urldelete "github.com/FacelessWayfarer/urlshortner/internal/handlers/url-delete"
 	urlget "github.com/FacelessWayfarer/urlshortner/internal/handlers/url-get"
+	urlhistory "github.com/FacelessWayfarer/urlshortner/internal/handlers/url-history"
+	urllist "github.com/FacelessWayfarer/urlshortner/internal/handlers/url-list"
 	urlsave "github.com/FacelessWayfarer/urlshortner/internal/handlers/url-save"
+	urlstats "github.com/FacelessWayfarer/urlshortner/internal/handlers/url-stats"
+	urlupdate "github.com/FacelessWayfarer/urlshortner/internal/handlers/url-update"
+	"github.com/FacelessWayfarer/urlshortner/internal/janitor"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/response"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/selflink"
 	"github.com/FacelessWayfarer/urlshortner/internal/lib/slogg"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/urlnorm"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/urlpolicy"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
@@ -20,19 +43,103 @@ const (
 	envProd  = "prod"
 )
 
+// shutdownTimeout is how long requests in flight may take to finish once the server is stopping
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	cfg := config.MustLoad()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(cfg, os.Stdout, os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	log := setupLogger(cfg.Env)
 
-	log.Info("starting urlshortner", slog.String("env:", cfg.Env))
+	log.Info("starting urlshortner", slog.String("env:", cfg.Env), slog.String("storage:", cfg.Storage))
 
-	db, err := sqllite.New(cfg.DatabasePath)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	db, err := setupStorage(cfg)
 	if err != nil {
 		log.Error("failed to init database", slogg.Err(err))
 		os.Exit(1)
 	}
 
+	if cfg.JanitorInterval > 0 {
+		go janitor.Run(ctx, log, db, cfg.JanitorInterval)
+	}
+
+	aliasGen, err := setupAliasGenerator(cfg)
+	if err != nil {
+		log.Error("failed to init alias generator", slogg.Err(err))
+		os.Exit(1)
+	}
+
+	saveOpts, err := setupSaveOptions(cfg, db)
+	if err != nil {
+		log.Error("failed to init url checks", slogg.Err(err))
+		os.Exit(1)
+	}
+
+	// the recorder outlives ctx so clicks of requests still in flight at shutdown are saved too
+	recorderCtx, stopRecorder := context.WithCancel(context.Background())
+	recorderDone := make(chan struct{})
+
+	recorder := clicks.NewRecorder(log, db)
+	go func() {
+		recorder.Run(recorderCtx)
+		close(recorderDone)
+	}()
+
+	router := setupRouter(log, cfg, db, recorder, aliasGen, saveOpts)
+
+	log.Info("starting server", slog.String("Port:", cfg.Address))
+
+	server := &http.Server{
+		Addr:         cfg.Address,
+		Handler:      router,
+		ReadTimeout:  cfg.HTTPServ.Timeout,
+		WriteTimeout: cfg.HTTPServ.Timeout,
+		IdleTimeout:  cfg.HTTPServ.IdleTimeout,
+	}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("failed to start server", slogg.Err(err))
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+
+	log.Info("stopping server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Error("failed to stop server gracefully", slogg.Err(err))
+	}
+
+	// every handler has returned, so the queue holds the last clicks
+	stopRecorder()
+	<-recorderDone
+
+	if closer, ok := db.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Error("failed to close database", slogg.Err(err))
+		}
+	}
+
+	log.Info("server stopped")
+}
+
+func setupRouter(log *slog.Logger, cfg *config.Cfg, db database.Storage, recorder urlget.ClickRecorder, aliasGen alias.Generator, saveOpts urlsave.Options) http.Handler {
 	router := chi.NewRouter()
 
 	router.Use(middleware.RequestID)
@@ -40,33 +147,46 @@ func main() {
 	// router.Use(mwLogger.New(log))
 	router.Use(middleware.Recoverer)
 	router.Use(middleware.URLFormat)
+	if cfg.HTTPServ.LegacyStatusCodes {
+		router.Use(response.LegacyStatusCodes)
+	}
 
 	router.Route("/url", func(r chi.Router) {
 		r.Use(middleware.BasicAuth("url-shortner", map[string]string{
 			cfg.HTTPServ.User: cfg.HTTPServ.Password,
 		}))
 
-		r.Post("/", urlsave.New(log, db, db))
+		r.Get("/", urllist.New(log, db))
+		r.Post("/", urlsave.New(log, db, aliasGen, saveOpts))
+		r.Post("/bulk", urlbulk.New(log, db, aliasGen, saveOpts))
 		r.Delete("/{alias}", urldelete.New(log, db))
+		r.Patch("/{alias}", urlupdate.New(log, db, saveOpts))
+		r.Get("/{alias}/stats", urlstats.New(log, db))
+		r.Get("/{alias}/history", urlhistory.New(log, db))
 	})
 
-	router.Get("/{alias}", urlget.New(log, db))
-
-	log.Info("starting server", slog.String("Port:", cfg.Address))
-
-	server := &http.Server{
-		Addr:         cfg.Address,
-		Handler:      router,
-		ReadTimeout:  cfg.HTTPServ.Timeout,
-		WriteTimeout: cfg.HTTPServ.Timeout,
-		IdleTimeout:  cfg.HTTPServ.IdleTimeout,
-	}
+	redirect := urlget.New(log, db, db, recorder, urlget.Options{
+		Policy:        saveOpts.Policy,
+		SelfLinks:     saveOpts.SelfLinks,
+		RedirectCode:  cfg.RedirectCode,
+		MaxAttempts:   cfg.LinkPassword.MaxAttempts,
+		AttemptWindow: cfg.LinkPassword.AttemptWindow,
+		NotYetActive: urlget.NotYetActive{
+			Status:  cfg.NotYetActive.Status,
+			Message: cfg.NotYetActive.Message,
+			URL:     cfg.NotYetActive.RedirectURL,
+		},
+	})
+	router.Get("/{alias}", redirect)
+	router.Get("/{alias}/*", redirect) // path suffixes for links that forward them
+	// password guesses for protected links
+	router.Post("/{alias}", redirect)
+	router.Post("/{alias}/*", redirect)
 
-	if err := server.ListenAndServe(); err != nil {
-		log.Error("failed to start server", slogg.Err(err))
-	}
+	// aliases equal to the first segment of a route would be shadowed by it
+	saveOpts.Aliases.Reserve(routeSegments(router)...)
 
-	log.Error("server stopped")
+	return router
 }
 
 func setupLogger(env string) *slog.Logger {
@@ -81,3 +201,81 @@ func setupLogger(env string) *slog.Logger {
 	}
 	return log
 }
+
+func setupAliasGenerator(cfg *config.Cfg) (alias.Generator, error) {
+	return alias.New(alias.Config{
+		Strategy: cfg.Alias.Strategy,
+		Length:   cfg.Alias.Length,
+		Alphabet: cfg.Alias.Alphabet,
+		Words:    cfg.Alias.Words,
+	})
+}
+
+// setupSaveOptions builds the checks urls and aliases go through before they are stored
+func setupSaveOptions(cfg *config.Cfg, db database.Storage) (urlsave.Options, error) {
+	policy, err := urlpolicy.New(urlpolicy.Config{
+		Schemes:      cfg.URLPolicy.Schemes,
+		AllowList:    cfg.URLPolicy.AllowList,
+		DenyList:     cfg.URLPolicy.DenyList,
+		BlockPrivate: cfg.URLPolicy.BlockPrivateIPs,
+	})
+	if err != nil {
+		return urlsave.Options{}, err
+	}
+
+	rules, err := alias.NewRules(cfg.Alias.MinLength, cfg.Alias.MaxLength, cfg.Alias.Reserved)
+	if err != nil {
+		return urlsave.Options{}, err
+	}
+
+	return urlsave.Options{
+		Dedup:     cfg.Dedup,
+		Normalize: urlnorm.Options{StripTracking: cfg.StripTrackingParams},
+		Policy:    policy,
+		SelfLinks: selflink.New(selflink.Config{
+			Hosts:           cfg.PublicHosts,
+			MaxDepth:        cfg.MaxRedirectDepth,
+			CaseInsensitive: cfg.CaseInsensitiveAliases,
+			Aliases:         rules, // the route segments are reserved once the router is set up
+		}, db),
+		Aliases: rules,
+	}, nil
+}
+
+// routeSegments lists the static first path segments of the registered routes
+func routeSegments(routes chi.Routes) []string {
+	var segments []string
+
+	_ = chi.Walk(routes, func(_ string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		segment, _, _ := strings.Cut(strings.TrimPrefix(route, "/"), "/")
+		if segment != "" && !strings.ContainsAny(segment, "{*") {
+			segments = append(segments, segment)
+		}
+		return nil
+	})
+
+	return segments
+}
+
+func setupStorage(cfg *config.Cfg) (database.Storage, error) {
+	switch cfg.Storage {
+	case config.StorageMemory:
+		return memory.New(), nil
+	case config.StoragePostgres:
+		db, err := postgres.New(cfg.PostgresDSN)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	default:
+		db, err := sqllite.New(cfg.DatabasePath)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.CaseInsensitiveAliases(cfg.CaseInsensitiveAliases); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+		return db, nil
+	}
+}
@@ -0,0 +1,694 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/alias"
+	"github.com/FacelessWayfarer/urlshortner/internal/clicks"
+	"github.com/FacelessWayfarer/urlshortner/internal/config"
+	"github.com/FacelessWayfarer/urlshortner/internal/database/memory"
+	urlsave "github.com/FacelessWayfarer/urlshortner/internal/handlers/url-save"
+	urlupdate "github.com/FacelessWayfarer/urlshortner/internal/handlers/url-update"
+	discardslogg "github.com/FacelessWayfarer/urlshortner/internal/lib/discard-slogg"
+	"github.com/gavv/httpexpect/v2"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testUser     = "user"
+	testPassword = "password"
+)
+
+// newTestServer spins up the full router in-process on top of the memory storage,
+// opts adjust the config before the router is built
+func newTestServer(t *testing.T, opts ...func(cfg *config.Cfg)) *httpexpect.Expect {
+	log := discardslogg.NewDiscardLogger()
+	db := memory.New()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	recorder := clicks.NewRecorder(log, db)
+	go recorder.Run(ctx)
+
+	cfg := &config.Cfg{
+		Storage: config.StorageMemory,
+		HTTPServ: config.HTTPServ{
+			User:     testUser,
+			Password: testPassword,
+		},
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	aliasGen, err := setupAliasGenerator(cfg)
+	require.NoError(t, err)
+
+	saveOpts, err := setupSaveOptions(cfg, db)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(setupRouter(log, cfg, db, recorder, aliasGen, saveOpts))
+	t.Cleanup(ts.Close)
+
+	return httpexpect.WithConfig(httpexpect.Config{
+		BaseURL:  ts.URL,
+		Reporter: httpexpect.NewRequireReporter(t),
+		Client: &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse // stop after 1st redirect
+			},
+		},
+	})
+}
+
+func TestRouter_SaveGetDelete(t *testing.T) {
+	e := newTestServer(t)
+
+	const (
+		alias     = "google"
+		url       = "HTTPS://Google.COM:443"
+		canonical = "https://google.com/"
+	)
+
+	saved := e.POST("/url").WithJSON(urlsave.Request{URL: url, Alias: alias}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object()
+	saved.Value("alias").String().IsEqual(alias)
+	saved.Value("url").String().IsEqual(canonical)
+
+	e.POST("/url").WithJSON(urlsave.Request{URL: url, Alias: alias}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusConflict).
+		JSON().Object().Value("error").String().IsEqual("url already exists")
+
+	e.GET("/" + alias).Expect().Status(http.StatusFound).Header("Location").IsEqual(canonical)
+
+	e.DELETE("/"+path.Join("url", alias)).WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK)
+
+	e.DELETE("/"+path.Join("url", alias)).WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusNotFound)
+
+	e.GET("/" + alias).Expect().Status(http.StatusNotFound).
+		JSON().Object().Value("error").String().IsEqual("not found")
+}
+
+func TestRouter_SequentialAliases(t *testing.T) {
+	e := newTestServer(t, func(cfg *config.Cfg) {
+		cfg.Alias.Strategy = alias.StrategySequential
+	})
+
+	for _, want := range []string{"1", "2"} {
+		e.POST("/url").WithJSON(urlsave.Request{URL: "https://google.com"}).
+			WithBasicAuth(testUser, testPassword).
+			Expect().Status(http.StatusOK).
+			JSON().Object().Value("alias").String().IsEqual(want)
+	}
+}
+
+func TestRouter_Dedup(t *testing.T) {
+	e := newTestServer(t, func(cfg *config.Cfg) {
+		cfg.Dedup = true
+	})
+
+	save := func(req urlsave.Request) *httpexpect.Object {
+		return e.POST("/url").WithJSON(req).
+			WithBasicAuth(testUser, testPassword).
+			Expect().Status(http.StatusOK).
+			JSON().Object()
+	}
+
+	first := save(urlsave.Request{URL: "https://google.com/search"})
+	first.NotContainsKey("existing")
+	alias := first.Value("alias").String().Raw()
+
+	again := save(urlsave.Request{URL: "HTTPS://GOOGLE.com:443/search"})
+	again.Value("alias").String().IsEqual(alias)
+	again.Value("existing").Boolean().IsTrue()
+
+	save(urlsave.Request{URL: "https://google.com/search", Force: true}).
+		Value("alias").String().NotEqual(alias)
+
+	save(urlsave.Request{URL: "https://google.com/search", TTL: "1h"}).
+		Value("alias").String().NotEqual(alias)
+}
+
+func TestRouter_StripTrackingParams(t *testing.T) {
+	e := newTestServer(t, func(cfg *config.Cfg) {
+		cfg.Dedup = true
+		cfg.StripTrackingParams = true
+	})
+
+	first := e.POST("/url").WithJSON(urlsave.Request{URL: "https://google.com/search?q=go&utm_source=mail"}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object()
+	first.Value("url").String().IsEqual("https://google.com/search?q=go")
+
+	e.POST("/url").WithJSON(urlsave.Request{URL: "https://google.com/search?fbclid=1&q=go"}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("alias").IsEqual(first.Value("alias").Raw())
+
+	e.POST("/url").WithJSON(urlsave.Request{URL: "https://exa mple.com"}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusBadRequest)
+}
+
+func TestRouter_URLPolicy(t *testing.T) {
+	e := newTestServer(t, func(cfg *config.Cfg) {
+		cfg.URLPolicy.BlockPrivateIPs = true
+	})
+
+	e.POST("/url").WithJSON(urlsave.Request{URL: "javascript:alert(1)"}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusBadRequest).
+		JSON().Object().Value("error").String().IsEqual(`url scheme is not allowed "javascript"`)
+
+	problem := e.POST("/url").WithJSON(urlsave.Request{URL: "http://127.0.0.1/admin"}).
+		WithBasicAuth(testUser, testPassword).
+		WithHeader("Accept", "application/problem+json").
+		Expect().Status(http.StatusBadRequest).
+		JSON(httpexpect.ContentOpts{MediaType: "application/problem+json"}).Object()
+	problem.Value("errors").Array().Value(0).Object().Value("tag").String().IsEqual("policy")
+
+	e.POST("/url").WithJSON(urlsave.Request{URL: "https://google.com", Alias: "google"}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK)
+
+	e.PATCH("/url/google").WithJSON(urlupdate.Request{URL: "http://localhost/"}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusBadRequest)
+
+	results := e.POST("/url/bulk").WithJSON([]urlsave.Request{
+		{URL: "https://google.com"},
+		{URL: "file:///etc/passwd"},
+	}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("results").Array()
+	results.Value(0).Object().Value("status").String().IsEqual("OK")
+	results.Value(1).Object().Value("error").String().IsEqual(`url scheme is not allowed "file"`)
+}
+
+func TestRouter_SelfLinks(t *testing.T) {
+	e := newTestServer(t, func(cfg *config.Cfg) {
+		cfg.PublicHosts = []string{"sho.rt"}
+	})
+
+	save := func(req urlsave.Request) *httpexpect.Response {
+		return e.POST("/url").WithJSON(req).WithBasicAuth(testUser, testPassword).Expect()
+	}
+
+	save(urlsave.Request{URL: "https://google.com", Alias: "google"}).Status(http.StatusOK)
+
+	save(urlsave.Request{URL: "https://sho.rt/google", Alias: "again"}).Status(http.StatusOK).
+		JSON().Object().Value("url").String().IsEqual("https://google.com/")
+
+	save(urlsave.Request{URL: "https://sho.rt/missing"}).Status(http.StatusBadRequest).
+		JSON().Object().Value("error").String().IsEqual(`short link destination does not exist "missing"`)
+
+	save(urlsave.Request{URL: "https://sho.rt/self", Alias: "self"}).Status(http.StatusBadRequest)
+
+	save(urlsave.Request{URL: "https://sho.rt/loop/x", Alias: "loop", ForwardPath: true}).Status(http.StatusBadRequest).
+		JSON().Object().Value("error").String().IsEqual(`short link points back at itself "loop"`)
+
+	save(urlsave.Request{URL: "https://sho.rt/google/x"}).Status(http.StatusBadRequest).
+		JSON().Object().Value("error").String().IsEqual(`short link does not forward paths "google"`)
+
+	e.PATCH("/url/google").WithJSON(urlupdate.Request{URL: "https://sho.rt/again"}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("url").String().IsEqual("https://google.com/")
+}
+
+func TestRouter_SelfLinkLoopThroughUpdate(t *testing.T) {
+	e := newTestServer(t, func(cfg *config.Cfg) {
+		cfg.PublicHosts = []string{"sho.rt"}
+	})
+
+	save := func(req urlsave.Request) *httpexpect.Response {
+		return e.POST("/url").WithJSON(req).WithBasicAuth(testUser, testPassword).Expect()
+	}
+
+	save(urlsave.Request{URL: "https://google.com", Alias: "aaa", Redirect: http.StatusMovedPermanently}).
+		Status(http.StatusOK)
+	save(urlsave.Request{URL: "https://sho.rt/aaa", Alias: "bbb", Redirect: http.StatusMovedPermanently}).
+		Status(http.StatusOK).
+		JSON().Object().Value("url").String().IsEqual("https://sho.rt/aaa")
+
+	// bbb keeps pointing at aaa, so aaa pointing back at bbb closes a loop
+	e.PATCH("/url/aaa").WithJSON(urlupdate.Request{URL: "https://sho.rt/bbb"}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusBadRequest).
+		JSON().Object().Value("error").String().IsEqual(`short link points back at itself "aaa"`)
+
+	e.GET("/bbb").Expect().Status(http.StatusMovedPermanently).
+		Header("Location").IsEqual("https://sho.rt/aaa")
+}
+
+func TestRouter_AliasRules(t *testing.T) {
+	e := newTestServer(t, func(cfg *config.Cfg) {
+		cfg.Alias.Reserved = []string{"health"}
+	})
+
+	cases := map[string]string{
+		"url":                   `alias is reserved "url"`,
+		"Health":                `alias is reserved "Health"`,
+		"a/b":                   `alias may contain only latin letters, digits, '-' and '_', got '/'`,
+		"ab":                    "alias length is out of range: must be from 3 to 64 characters, got 2",
+		strings.Repeat("a", 65): "alias length is out of range: must be from 3 to 64 characters, got 65",
+	}
+	for a, msg := range cases {
+		e.POST("/url").WithJSON(urlsave.Request{URL: "https://google.com", Alias: a}).
+			WithBasicAuth(testUser, testPassword).
+			Expect().Status(http.StatusBadRequest).
+			JSON().Object().Value("error").String().IsEqual(msg)
+	}
+
+	e.POST("/url").WithJSON(urlsave.Request{URL: "https://google.com", Alias: "my-link_1"}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK)
+
+	e.POST("/url/bulk").WithJSON([]urlsave.Request{{URL: "https://google.com", Alias: "url"}}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("results").Array().Value(0).Object().
+		Value("error").String().IsEqual(`alias is reserved "url"`)
+}
+
+// routeAliases hands out "url" first, the segment of the management routes
+type routeAliases struct{}
+
+func (routeAliases) Generate(id int64, attempt int) (string, error) {
+	if attempt == 0 {
+		return "url", nil
+	}
+	return alias.Sequential{}.Generate(id, attempt)
+}
+
+func TestRouter_GeneratedAliasNotReserved(t *testing.T) {
+	log := discardslogg.NewDiscardLogger()
+	db := memory.New()
+	cfg := &config.Cfg{
+		Storage:  config.StorageMemory,
+		HTTPServ: config.HTTPServ{User: testUser, Password: testPassword},
+	}
+
+	saveOpts, err := setupSaveOptions(cfg, db)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(setupRouter(log, cfg, db, clicks.NewRecorder(log, db), routeAliases{}, saveOpts))
+	t.Cleanup(ts.Close)
+
+	e := httpexpect.WithConfig(httpexpect.Config{
+		BaseURL:  ts.URL,
+		Reporter: httpexpect.NewRequireReporter(t),
+		Client: &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	})
+
+	generated := e.POST("/url").WithJSON(urlsave.Request{URL: "https://google.com"}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("alias").String().NotEqual("url").Raw()
+
+	bulk := e.POST("/url/bulk").WithJSON([]urlsave.Request{{URL: "https://yandex.ru"}}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("results").Array().Value(0).Object()
+	bulk.Value("alias").String().NotEqual("url")
+
+	e.GET("/" + generated).Expect().Status(http.StatusFound).Header("Location").IsEqual("https://google.com/")
+}
+
+func TestRouter_RedirectCodes(t *testing.T) {
+	e := newTestServer(t, func(cfg *config.Cfg) {
+		cfg.RedirectCode = http.StatusTemporaryRedirect
+	})
+
+	e.POST("/url").WithJSON(urlsave.Request{URL: "https://google.com", Alias: "default"}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object().NotContainsKey("redirect")
+
+	e.POST("/url").WithJSON(urlsave.Request{URL: "https://google.com", Alias: "permanent", Redirect: http.StatusMovedPermanently}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("redirect").Number().IsEqual(http.StatusMovedPermanently)
+
+	e.POST("/url").WithJSON(urlsave.Request{URL: "https://google.com", Alias: "broken", Redirect: http.StatusOK}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusBadRequest).
+		JSON().Object().Value("error").String().IsEqual("field Redirect must be one of 301 302 303 307 308")
+
+	e.GET("/default").Expect().Status(http.StatusTemporaryRedirect).Header("Location").IsEqual("https://google.com/")
+	e.GET("/permanent").Expect().Status(http.StatusMovedPermanently).Header("Location").IsEqual("https://google.com/")
+}
+
+func TestRouter_Forwarding(t *testing.T) {
+	e := newTestServer(t)
+
+	e.POST("/url").WithJSON(urlsave.Request{URL: "https://docs.example.com/v2/", Alias: "docs", ForwardPath: true, ForwardQuery: true}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object().ContainsSubset(map[string]any{"forward_path": true, "forward_query": true})
+
+	e.POST("/url").WithJSON(urlsave.Request{URL: "https://docs.example.com/v2/", Alias: "plain"}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK)
+
+	e.GET("/docs/guide/page.html").WithQuery("ref", "x").
+		Expect().Status(http.StatusFound).
+		Header("Location").IsEqual("https://docs.example.com/v2/guide/page.html?ref=x")
+
+	e.GET("/plain").WithQuery("ref", "x").
+		Expect().Status(http.StatusFound).
+		Header("Location").IsEqual("https://docs.example.com/v2/")
+	e.GET("/plain/guide").Expect().Status(http.StatusNotFound)
+}
+
+func TestRouter_Params(t *testing.T) {
+	e := newTestServer(t, func(cfg *config.Cfg) {
+		cfg.PublicHosts = []string{"sho.rt"}
+	})
+
+	e.POST("/url").WithJSON(urlsave.Request{
+		URL:    "https://shop.example.com/spring",
+		Alias:  "spring",
+		Params: map[string]string{"utm_source": "newsletter", "utm_campaign": "{alias}_{date}"},
+	}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("params").Object().Value("utm_source").IsEqual("newsletter")
+
+	e.POST("/url").WithJSON(urlsave.Request{URL: "https://shop.example.com/", Alias: "broken", Params: map[string]string{"utm_source": "{user}"}}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusBadRequest).
+		JSON().Object().Value("error").String().Contains("unknown placeholder {user}")
+
+	date := time.Now().UTC().Format(time.DateOnly)
+	e.GET("/spring").Expect().Status(http.StatusFound).
+		Header("Location").IsEqual("https://shop.example.com/spring?utm_campaign=spring_" + date + "&utm_source=newsletter")
+
+	// a link to the tagged one is not flattened, so its parameters are not lost
+	e.POST("/url").WithJSON(urlsave.Request{URL: "https://sho.rt/spring", Alias: "promo"}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("url").String().IsEqual("https://sho.rt/spring")
+	e.GET("/promo").Expect().Status(http.StatusFound).
+		Header("Location").IsEqual("https://sho.rt/spring")
+}
+
+func TestRouter_Password(t *testing.T) {
+	e := newTestServer(t)
+
+	obj := e.POST("/url").WithJSON(urlsave.Request{URL: "https://docs.example.com/internal", Alias: "internal", Password: "s3cret"}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object()
+	obj.Value("protected").Boolean().IsTrue()
+	obj.NotContainsKey("password")
+
+	e.POST("/url").WithJSON(urlsave.Request{URL: "https://docs.example.com/", Alias: "short", Password: "abc"}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusBadRequest)
+
+	e.GET("/internal").Expect().Status(http.StatusOK).
+		ContentType("text/html").Body().Contains(`name="password"`)
+
+	e.POST("/internal").WithFormField("password", "wrong").Expect().Status(http.StatusForbidden)
+	e.POST("/internal").WithFormField("password", "s3cret").Expect().Status(http.StatusSeeOther).
+		Header("Location").IsEqual("https://docs.example.com/internal")
+}
+
+func TestRouter_MaxVisits(t *testing.T) {
+	e := newTestServer(t)
+
+	e.POST("/url").WithJSON(urlsave.Request{URL: "https://example.com/invite", Alias: "invite", MaxVisits: 2}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("visits_left").Number().IsEqual(2)
+
+	e.POST("/url").WithJSON(urlsave.Request{URL: "https://example.com/", Alias: "negative", MaxVisits: -1}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusBadRequest).
+		JSON().Object().Value("error").String().IsEqual("field MaxVisits must be at least 1")
+
+	e.GET("/invite").Expect().Status(http.StatusFound)
+	e.GET("/invite").Expect().Status(http.StatusFound)
+	e.GET("/invite").Expect().Status(http.StatusGone)
+
+	e.GET("/url").WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("links").Array().Value(0).Object().Value("visits_left").Number().IsEqual(0)
+}
+
+func TestRouter_ActivationWindow(t *testing.T) {
+	launch := time.Now().Add(time.Hour)
+	started := time.Now().Add(-time.Hour)
+
+	e := newTestServer(t)
+
+	e.POST("/url").WithJSON(urlsave.Request{URL: "https://example.com/launch", Alias: "launch", ActiveFrom: &launch}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object().ContainsKey("active_from")
+
+	e.POST("/url").WithJSON(urlsave.Request{URL: "https://example.com/sale", Alias: "sale", ActiveFrom: &started, ActiveUntil: &launch}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object().ContainsKey("expires_at")
+
+	e.GET("/launch").Expect().Status(http.StatusNotFound).
+		JSON().Object().Value("error").String().IsEqual("not yet available")
+	e.GET("/sale").Expect().Status(http.StatusFound)
+
+	soon := newTestServer(t, func(cfg *config.Cfg) {
+		cfg.NotYetActive.RedirectURL = "https://example.com/coming-soon"
+	})
+
+	soon.POST("/url").WithJSON(urlsave.Request{URL: "https://example.com/launch", Alias: "launch", ActiveFrom: &launch}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK)
+
+	soon.GET("/launch").Expect().Status(http.StatusFound).
+		Header("Location").IsEqual("https://example.com/coming-soon")
+}
+
+func TestRouter_LegacyStatusCodes(t *testing.T) {
+	e := newTestServer(t, func(cfg *config.Cfg) {
+		cfg.HTTPServ.LegacyStatusCodes = true
+	})
+
+	e.POST("/url").WithJSON(urlsave.Request{URL: "not a url"}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("status").String().IsEqual("Error")
+
+	e.GET("/missing").Expect().Status(http.StatusOK).
+		JSON().Object().Value("error").String().IsEqual("not found")
+}
+
+func TestRouter_Stats(t *testing.T) {
+	e := newTestServer(t)
+
+	e.POST("/url").WithJSON(urlsave.Request{URL: "https://google.com", Alias: "google"}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK)
+
+	e.GET("/google").Expect().Status(http.StatusFound)
+	e.GET("/google").Expect().Status(http.StatusFound)
+
+	require.Eventually(t, func() bool {
+		return e.GET("/url/google/stats").WithBasicAuth(testUser, testPassword).
+			Expect().Status(http.StatusOK).
+			JSON().Object().Value("total").Number().Raw() == 2
+	}, 5*time.Second, 100*time.Millisecond)
+
+	e.GET("/url/missing/stats").WithBasicAuth(testUser, testPassword).
+		Expect().JSON().Object().Value("error").String().IsEqual("not found")
+
+	e.GET("/url/google/stats").Expect().Status(http.StatusUnauthorized)
+}
+
+func TestRouter_Update(t *testing.T) {
+	e := newTestServer(t)
+
+	e.POST("/url").WithJSON(urlsave.Request{URL: "https://google.com", Alias: "google"}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK)
+
+	e.PATCH("/url/google").WithJSON(urlupdate.Request{URL: "https://yandex.ru"}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("previous_url").String().IsEqual("https://google.com/")
+
+	e.GET("/google").Expect().Status(http.StatusFound).Header("Location").IsEqual("https://yandex.ru/")
+
+	history := e.GET("/url/google/history").WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("history").Array()
+	history.Length().IsEqual(1)
+	history.Value(0).Object().Value("url").String().IsEqual("https://google.com/")
+
+	e.PATCH("/url/missing").WithJSON(urlupdate.Request{URL: "https://yandex.ru"}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().JSON().Object().Value("error").String().IsEqual("not found")
+
+	e.PATCH("/url/google").WithJSON(urlupdate.Request{URL: "https://bing.com"}).
+		Expect().Status(http.StatusUnauthorized)
+}
+
+func TestRouter_List(t *testing.T) {
+	e := newTestServer(t)
+
+	for _, alias := range []string{"docs_a", "docs_b", "docs_c", "blog"} {
+		e.POST("/url").WithJSON(urlsave.Request{URL: "https://example.com/" + alias, Alias: alias}).
+			WithBasicAuth(testUser, testPassword).
+			Expect().Status(http.StatusOK)
+	}
+
+	page := e.GET("/url").WithQuery("alias_prefix", "docs_").WithQuery("limit", 2).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).JSON().Object()
+	page.Value("links").Array().Length().IsEqual(2)
+	page.Value("links").Array().Value(0).Object().Value("alias").String().IsEqual("docs_c")
+	page.Value("links").Array().Value(0).Object().ContainsKey("created_at")
+
+	cursor := page.Value("next_cursor").String().NotEmpty().Raw()
+
+	page = e.GET("/url").WithQuery("alias_prefix", "docs_").WithQuery("limit", 2).WithQuery("cursor", cursor).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).JSON().Object()
+	page.Value("links").Array().Length().IsEqual(1)
+	page.Value("links").Array().Value(0).Object().Value("alias").String().IsEqual("docs_a")
+	page.NotContainsKey("next_cursor")
+
+	e.GET("/url").WithQuery("url_contains", "blog").WithQuery("order", "asc").
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("links").Array().Length().IsEqual(1)
+
+	e.GET("/url").WithQuery("cursor", "garbage").
+		WithBasicAuth(testUser, testPassword).
+		Expect().JSON().Object().Value("error").String().IsEqual("invalid cursor")
+
+	e.GET("/url").Expect().Status(http.StatusUnauthorized)
+}
+
+func TestRouter_Bulk(t *testing.T) {
+	e := newTestServer(t)
+
+	e.POST("/url").WithJSON(urlsave.Request{URL: "https://google.com", Alias: "taken"}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK)
+
+	results := e.POST("/url/bulk").WithJSON([]urlsave.Request{
+		{URL: "https://google.com", Alias: "first"},
+		{URL: "not a url"},
+		{URL: "https://google.com", Alias: "taken"},
+		{URL: "https://google.com", TTL: "1h"},
+	}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("results").Array()
+
+	results.Length().IsEqual(4)
+	results.Value(0).Object().Value("alias").String().IsEqual("first")
+	results.Value(1).Object().Value("error").String().IsEqual("field URL is not a valid URL")
+	results.Value(2).Object().Value("error").String().IsEqual("url already exists")
+	results.Value(3).Object().ContainsKey("expires_at")
+
+	generated := results.Value(3).Object().Value("alias").String().NotEmpty().Raw()
+
+	e.GET("/first").Expect().Status(http.StatusFound)
+	e.GET("/" + generated).Expect().Status(http.StatusFound)
+
+	e.POST("/url/bulk").WithJSON([]urlsave.Request{}).
+		WithBasicAuth(testUser, testPassword).
+		Expect().JSON().Object().Value("status").String().IsEqual("Error")
+}
+
+func TestRouter_BulkTooLarge(t *testing.T) {
+	e := newTestServer(t)
+
+	body := `[{"url":"https://google.com/` + strings.Repeat("a", 5<<20) + `"}]`
+
+	e.POST("/url/bulk").WithBytes([]byte(body)).WithHeader("Content-Type", "application/json").
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusBadRequest).
+		JSON().Object().Value("error").String().IsEqual("failed to decode request")
+}
+
+func TestRouter_BulkPasswords(t *testing.T) {
+	const protected = 20 // the cap on items with a password in one bulk request
+
+	e := newTestServer(t)
+
+	items := make([]urlsave.Request, protected+1)
+	for i := range items {
+		items[i] = urlsave.Request{URL: "https://docs.example.com/", Alias: "doc" + strconv.Itoa(i), Password: "s3cret"}
+	}
+
+	e.POST("/url/bulk").WithJSON(items[:protected]).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("results").Array().Value(protected - 1).Object().Value("protected").Boolean().IsTrue()
+
+	for i := range items {
+		items[i].Alias = "more" + strconv.Itoa(i)
+	}
+
+	// one password too many refuses the whole request, nothing of it is saved
+	e.POST("/url/bulk").WithJSON(items).
+		WithBasicAuth(testUser, testPassword).
+		Expect().Status(http.StatusBadRequest).
+		JSON().Object().Value("error").String().IsEqual("request may contain at most 20 items with a password")
+
+	e.GET("/more0").Expect().Status(http.StatusNotFound)
+}
+
+func TestRouter_Unauthorized(t *testing.T) {
+	e := newTestServer(t)
+
+	e.POST("/url").WithJSON(urlsave.Request{URL: "https://google.com"}).
+		Expect().Status(http.StatusUnauthorized)
+}
+
+func TestMigrate(t *testing.T) {
+	cfg := &config.Cfg{
+		Storage:      config.StorageSQLite,
+		DatabasePath: filepath.Join(t.TempDir(), "database.db"),
+	}
+
+	var out bytes.Buffer
+
+	require.NoError(t, runMigrate(cfg, &out, []string{"status"}))
+	require.Contains(t, out.String(), "pending")
+
+	out.Reset()
+	require.NoError(t, runMigrate(cfg, &out, []string{"up"}))
+	require.Contains(t, out.String(), "applied 0001_create_url")
+
+	out.Reset()
+	require.NoError(t, runMigrate(cfg, &out, []string{"down"}))
+	require.Contains(t, out.String(), "rolled back ")
+
+	require.Error(t, runMigrate(cfg, &out, []string{"sideways"}))
+	require.Error(t, runMigrate(cfg, &out, []string{"down", "zero"}))
+}
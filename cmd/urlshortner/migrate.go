@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/config"
+	"github.com/FacelessWayfarer/urlshortner/internal/database/migrate"
+	"github.com/FacelessWayfarer/urlshortner/internal/database/postgres"
+	"github.com/FacelessWayfarer/urlshortner/internal/database/sqllite"
+)
+
+const migrateUsage = `usage: urlshortner migrate <command>
+
+commands:
+  status        list migrations and whether they are applied
+  up            apply every pending migration
+  down [steps]  roll back the last applied migrations, 1 by default`
+
+var errMigrateUsage = errors.New(migrateUsage)
+
+// runMigrate implements the migrate subcommand for the configured storage
+func runMigrate(cfg *config.Cfg, out io.Writer, args []string) error {
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+
+	migrator, closeDB, err := openMigrator(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	switch args[0] {
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		printStatus(out, statuses)
+
+	case "up":
+		applied, err := migrator.Up()
+		for _, m := range applied {
+			fmt.Fprintf(out, "applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "nothing to apply")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return errMigrateUsage
+			}
+		}
+
+		reverted, err := migrator.Down(steps)
+		for _, m := range reverted {
+			fmt.Fprintf(out, "rolled back %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Fprintln(out, "nothing to roll back")
+		}
+
+	default:
+		return errMigrateUsage
+	}
+
+	return nil
+}
+
+func openMigrator(cfg *config.Cfg) (*migrate.Migrator, func(), error) {
+	switch cfg.Storage {
+	case config.StoragePostgres:
+		db, err := postgres.Open(cfg.PostgresDSN)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db.Migrator(), func() { _ = db.Close() }, nil
+	case config.StorageSQLite:
+		db, err := sqllite.Open(cfg.DatabasePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db.Migrator(), func() { _ = db.Close() }, nil
+	default:
+		return nil, nil, fmt.Errorf("storage %q has no schema to migrate", cfg.Storage)
+	}
+}
+
+func printStatus(out io.Writer, statuses []migrate.Status) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, s := range statuses {
+		appliedAt := "pending"
+		if s.Applied {
+			appliedAt = s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+	}
+}
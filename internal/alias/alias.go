@@ -0,0 +1,211 @@
+// Package alias makes aliases for links saved without one.
+package alias
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync/atomic"
+)
+
+// supported generation strategies
+const (
+	StrategyRandom     = "random"
+	StrategySequential = "sequential"
+	StrategyWords      = "words"
+)
+
+const (
+	// DefaultAlphabet leaves out characters that are easy to mix up: 0/O/o, 1/l/I
+	DefaultAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnpqrstuvwxyz23456789"
+	DefaultLength   = 5
+	DefaultWords    = 3
+
+	// growAt is the attempt at which the keyspace counts as dense and aliases get longer
+	growAt    = 2
+	maxLength = 16
+	maxWords  = 6
+
+	base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+var (
+	ErrUnknownStrategy = errors.New("unknown alias strategy")
+	ErrInvalidLength   = errors.New("alias length must be positive")
+	ErrInvalidAlphabet = errors.New("alias alphabet needs at least 2 distinct characters")
+)
+
+// Generator makes an alias for the link saved under row id id,
+// attempt counts the aliases already found taken for the link.
+// Strategies that do not derive the alias from the id ignore it.
+type Generator interface {
+	Generate(id int64, attempt int) (string, error)
+}
+
+// Config selects and tunes a strategy, zero values fall back to the defaults
+type Config struct {
+	Strategy string
+	Length   int    // random aliases
+	Alphabet string // random aliases
+	Words    int    // word aliases
+}
+
+func New(cfg Config) (Generator, error) {
+	const mark = "alias.New"
+
+	var (
+		gen Generator
+		err error
+	)
+
+	switch cfg.Strategy {
+	case "", StrategyRandom:
+		gen, err = NewRandom(cfg.Length, cfg.Alphabet)
+	case StrategySequential:
+		gen = Sequential{}
+	case StrategyWords:
+		gen, err = NewWords(cfg.Words)
+	default:
+		err = fmt.Errorf("%w %q", ErrUnknownStrategy, cfg.Strategy)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return gen, nil
+}
+
+// Random picks every character from the alphabet with crypto/rand.
+// Repeated collisions make every later alias one character longer.
+type Random struct {
+	length   atomic.Int64
+	alphabet []rune
+}
+
+func NewRandom(length int, alphabet string) (*Random, error) {
+	if length == 0 {
+		length = DefaultLength
+	}
+	if length < 0 {
+		return nil, ErrInvalidLength
+	}
+
+	if alphabet == "" {
+		alphabet = DefaultAlphabet
+	}
+	chars := distinct(alphabet)
+	if len(chars) < 2 {
+		return nil, ErrInvalidAlphabet
+	}
+
+	g := &Random{alphabet: chars}
+	g.length.Store(int64(length))
+
+	return g, nil
+}
+
+func (g *Random) Generate(_ int64, attempt int) (string, error) {
+	return pick(g.alphabet, int(grow(&g.length, attempt, maxLength)))
+}
+
+// Length is the current length of generated aliases
+func (g *Random) Length() int {
+	return int(g.length.Load())
+}
+
+// Sequential encodes the row id in base62, aliases are as short as possible and never collide with each other
+type Sequential struct{}
+
+func (Sequential) Generate(id int64, _ int) (string, error) {
+	if id <= 0 {
+		return "", fmt.Errorf("alias.Sequential: invalid id %d", id)
+	}
+
+	var b []byte
+	for ; id > 0; id /= 62 {
+		b = append(b, base62[id%62])
+	}
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+
+	return string(b), nil
+}
+
+// Words joins random dictionary words with dashes, e.g. "amber-fox-lamp".
+// Repeated collisions add a word to every later alias.
+type Words struct {
+	count atomic.Int64
+}
+
+func NewWords(count int) (*Words, error) {
+	if count == 0 {
+		count = DefaultWords
+	}
+	if count < 0 {
+		return nil, ErrInvalidLength
+	}
+
+	g := &Words{}
+	g.count.Store(int64(count))
+
+	return g, nil
+}
+
+func (g *Words) Generate(_ int64, attempt int) (string, error) {
+	parts := make([]string, grow(&g.count, attempt, maxWords))
+	for i := range parts {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(words))))
+		if err != nil {
+			return "", fmt.Errorf("alias.Words:%w", err)
+		}
+		parts[i] = words[n.Int64()]
+	}
+
+	return strings.Join(parts, "-"), nil
+}
+
+// grow returns the size to generate with, bumping it for good once attempt shows the keyspace is dense
+func grow(size *atomic.Int64, attempt int, max int64) int64 {
+	current := size.Load()
+	if attempt != growAt || current >= max {
+		return current
+	}
+
+	// concurrent collisions grow the size once, a lost race uses the winner's size
+	if size.CompareAndSwap(current, current+1) {
+		return current + 1
+	}
+	return size.Load()
+}
+
+func pick(alphabet []rune, length int) (string, error) {
+	max := big.NewInt(int64(len(alphabet)))
+
+	alias := make([]rune, length)
+	for i := range alias {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("alias.pick:%w", err)
+		}
+		alias[i] = alphabet[n.Int64()]
+	}
+
+	return string(alias), nil
+}
+
+func distinct(s string) []rune {
+	seen := make(map[rune]bool, len(s))
+
+	var chars []rune
+	for _, c := range s {
+		if !seen[c] {
+			seen[c] = true
+			chars = append(chars, c)
+		}
+	}
+
+	return chars
+}
@@ -0,0 +1,91 @@
+package alias
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	DefaultMinLength = 3
+	DefaultMaxLength = 64
+)
+
+var (
+	ErrAliasLength   = errors.New("alias length is out of range")
+	ErrAliasCharset  = errors.New("alias may contain only latin letters, digits, '-' and '_'")
+	ErrAliasReserved = errors.New("alias is reserved")
+)
+
+// Rules decide which aliases clients may choose themselves,
+// generated aliases are only kept off the reserved words, see Reserved
+type Rules struct {
+	minLength int
+	maxLength int
+	reserved  map[string]bool // lowercase
+}
+
+// NewRules makes rules for aliases from minLength to maxLength characters long,
+// zero lengths fall back to the defaults. Reserved words are matched ignoring case.
+func NewRules(minLength, maxLength int, reserved []string) (*Rules, error) {
+	if minLength == 0 {
+		minLength = DefaultMinLength
+	}
+	if maxLength == 0 {
+		maxLength = DefaultMaxLength
+	}
+	if minLength < 0 || maxLength < minLength {
+		return nil, fmt.Errorf("alias.NewRules:%w: %d..%d", ErrInvalidLength, minLength, maxLength)
+	}
+
+	r := &Rules{
+		minLength: minLength,
+		maxLength: maxLength,
+		reserved:  make(map[string]bool, len(reserved)),
+	}
+	r.Reserve(reserved...)
+
+	return r, nil
+}
+
+// Reserve adds reserved words, it must not be called while aliases are being checked
+func (r *Rules) Reserve(words ...string) {
+	for _, word := range words {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			r.reserved[word] = true
+		}
+	}
+}
+
+// Check explains why alias may not be chosen, a nil Rules allows everything
+func (r *Rules) Check(alias string) error {
+	if r == nil {
+		return nil
+	}
+
+	if n := utf8.RuneCountInString(alias); n < r.minLength || n > r.maxLength {
+		return fmt.Errorf("%w: must be from %d to %d characters, got %d", ErrAliasLength, r.minLength, r.maxLength, n)
+	}
+
+	for _, c := range alias {
+		if !isAliasChar(c) {
+			return fmt.Errorf("%w, got %q", ErrAliasCharset, c)
+		}
+	}
+
+	if r.Reserved(alias) {
+		return fmt.Errorf("%w %q", ErrAliasReserved, alias)
+	}
+
+	return nil
+}
+
+// Reserved reports whether alias is a reserved word, a nil Rules reserves nothing
+func (r *Rules) Reserved(alias string) bool {
+	return r != nil && r.reserved[strings.ToLower(alias)]
+}
+
+func isAliasChar(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+}
@@ -0,0 +1,144 @@
+package aliastest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/alias"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRandom(t *testing.T) {
+	gen, err := alias.NewRandom(0, "")
+	require.NoError(t, err)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		a, err := gen.Generate(0, 0)
+		require.NoError(t, err)
+		require.Len(t, a, alias.DefaultLength)
+		for _, c := range a {
+			require.True(t, strings.ContainsRune(alias.DefaultAlphabet, c), a)
+		}
+		seen[a] = true
+	}
+	require.Greater(t, len(seen), 90, "aliases must not repeat")
+
+	gen, err = alias.NewRandom(8, "ab")
+	require.NoError(t, err)
+
+	a, err := gen.Generate(0, 0)
+	require.NoError(t, err)
+	require.Len(t, a, 8)
+	require.Empty(t, strings.Trim(a, "ab"))
+}
+
+func TestRandom_Grows(t *testing.T) {
+	gen, err := alias.NewRandom(5, "")
+	require.NoError(t, err)
+
+	a, err := gen.Generate(0, 1)
+	require.NoError(t, err)
+	require.Len(t, a, 5, "a single collision is not a dense keyspace")
+
+	a, err = gen.Generate(0, 2)
+	require.NoError(t, err)
+	require.Len(t, a, 6)
+
+	a, err = gen.Generate(0, 0)
+	require.NoError(t, err)
+	require.Len(t, a, 6, "growth must stick for later links")
+	require.Equal(t, 6, gen.Length())
+}
+
+func TestWords_Grows(t *testing.T) {
+	gen, err := alias.NewWords(2)
+	require.NoError(t, err)
+
+	_, err = gen.Generate(0, 2)
+	require.NoError(t, err)
+
+	a, err := gen.Generate(0, 0)
+	require.NoError(t, err)
+	require.Len(t, strings.Split(a, "-"), 3)
+}
+
+func TestRandom_Invalid(t *testing.T) {
+	_, err := alias.NewRandom(-1, "")
+	require.ErrorIs(t, err, alias.ErrInvalidLength)
+
+	_, err = alias.NewRandom(5, "aaaa")
+	require.ErrorIs(t, err, alias.ErrInvalidAlphabet)
+}
+
+func TestSequential(t *testing.T) {
+	cases := map[int64]string{
+		1:       "1",
+		10:      "A",
+		61:      "z",
+		62:      "10",
+		3843:    "zz",
+		1000000: "4C92",
+	}
+
+	for id, want := range cases {
+		got, err := alias.Sequential{}.Generate(id, 0)
+		require.NoError(t, err)
+		require.Equal(t, want, got, id)
+	}
+
+	_, err := alias.Sequential{}.Generate(0, 0)
+	require.Error(t, err)
+}
+
+func TestWords(t *testing.T) {
+	gen, err := alias.NewWords(2)
+	require.NoError(t, err)
+
+	a, err := gen.Generate(0, 0)
+	require.NoError(t, err)
+
+	parts := strings.Split(a, "-")
+	require.Len(t, parts, 2)
+	for _, p := range parts {
+		require.NotEmpty(t, p)
+		require.Equal(t, strings.ToLower(p), p)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, strategy := range []string{"", alias.StrategyRandom, alias.StrategySequential, alias.StrategyWords} {
+		gen, err := alias.New(alias.Config{Strategy: strategy})
+		require.NoError(t, err, strategy)
+		require.NotNil(t, gen)
+	}
+
+	_, err := alias.New(alias.Config{Strategy: "uuid"})
+	require.ErrorIs(t, err, alias.ErrUnknownStrategy)
+}
+
+func TestRules(t *testing.T) {
+	rules, err := alias.NewRules(0, 10, []string{"Health", " metrics "})
+	require.NoError(t, err)
+	rules.Reserve("url")
+
+	for _, a := range []string{"abc", "my-link_2", "ABCDEFGHIJ", "amber-fox"} {
+		require.NoError(t, rules.Check(a), a)
+	}
+
+	require.ErrorIs(t, rules.Check("ab"), alias.ErrAliasLength)
+	require.ErrorIs(t, rules.Check(strings.Repeat("a", 11)), alias.ErrAliasLength)
+	require.ErrorIs(t, rules.Check("a/b/c"), alias.ErrAliasCharset)
+	require.ErrorIs(t, rules.Check("a b c"), alias.ErrAliasCharset)
+	require.ErrorIs(t, rules.Check("ссылка"), alias.ErrAliasCharset)
+	require.ErrorIs(t, rules.Check("a.json"), alias.ErrAliasCharset)
+	require.ErrorIs(t, rules.Check("url"), alias.ErrAliasReserved)
+	require.ErrorIs(t, rules.Check("HEALTH"), alias.ErrAliasReserved)
+	require.ErrorIs(t, rules.Check("metrics"), alias.ErrAliasReserved)
+
+	_, err = alias.NewRules(5, 4, nil)
+	require.ErrorIs(t, err, alias.ErrInvalidLength)
+
+	var none *alias.Rules
+	require.NoError(t, none.Check("a/b"))
+}
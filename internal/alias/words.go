@@ -0,0 +1,24 @@
+package alias
+
+// words is the dictionary of word aliases, short lowercase nouns that are easy to read aloud
+var words = []string{
+	"acorn", "amber", "anchor", "apple", "arrow", "aspen", "atlas", "autumn", "badge", "bamboo",
+	"banjo", "barley", "basil", "beacon", "berry", "birch", "bison", "blaze", "bloom", "bluff",
+	"bolt", "border", "breeze", "brick", "bridge", "brook", "bubble", "cabin", "cactus", "camel",
+	"candle", "canyon", "canvas", "carbon", "cargo", "castle", "cedar", "cellar", "chalk", "cherry",
+	"cider", "circle", "citrus", "clay", "cliff", "clover", "cobalt", "comet", "copper", "coral",
+	"cotton", "crane", "crater", "crystal", "cup", "dawn", "delta", "desert", "dune", "eagle", "echo",
+	"ember", "falcon", "feather", "fern", "fiddle", "field", "fig", "flame", "flint", "forest",
+	"fossil", "fox", "frost", "garden", "garnet", "geyser", "ginger", "glacier", "globe", "granite",
+	"grape", "grove", "harbor", "hazel", "heron", "hill", "honey", "horizon", "island", "ivory",
+	"jade", "jasmine", "jungle", "kettle", "kite", "lagoon", "lake", "lantern", "lemon", "lily",
+	"lime", "linen", "lotus", "maple", "marble", "meadow", "melon", "mint", "moss", "mountain",
+	"nectar", "nest", "nickel", "oak", "oasis", "ocean", "olive", "onyx", "orbit", "orchid", "otter",
+	"owl", "palm", "panda", "paper", "pearl", "pebble", "pepper", "piano", "pine", "planet", "plum",
+	"pond", "poppy", "prairie", "quartz", "quill", "rabbit", "raven", "reef", "ridge", "river",
+	"robin", "rocket", "ruby", "saffron", "sage", "salmon", "sand", "satin", "shadow", "shell",
+	"silk", "silver", "sky", "slate", "snow", "sparrow", "spruce", "star", "stone", "storm", "summit",
+	"sun", "swan", "thistle", "thunder", "tide", "tiger", "timber", "topaz", "tulip", "tundra",
+	"valley", "velvet", "violet", "walnut", "wave", "willow", "wind", "winter", "wolf", "wren",
+	"yarrow", "zebra", "zephyr",
+}
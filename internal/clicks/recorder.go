@@ -0,0 +1,87 @@
+// Package clicks records redirects in the background so the redirect itself never waits on the database.
+package clicks
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/database"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/slogg"
+)
+
+const (
+	bufferSize    = 1024        // clicks waiting to be saved, newer clicks are dropped when it is full
+	batchSize     = 100         // clicks saved in one transaction
+	flushInterval = time.Second // how long a click may wait for its batch to fill up
+)
+
+type ClickSaver interface {
+	SaveClicks(clicks []database.Click) error
+}
+
+type Recorder struct {
+	log    *slog.Logger
+	saver  ClickSaver
+	clicks chan database.Click
+}
+
+func NewRecorder(log *slog.Logger, saver ClickSaver) *Recorder {
+	return &Recorder{
+		log:    log.With(slog.String("component", "clicks/recorder")),
+		saver:  saver,
+		clicks: make(chan database.Click, bufferSize),
+	}
+}
+
+// Record queues the click without blocking, the click is dropped if the queue is full
+func (r *Recorder) Record(click database.Click) {
+	select {
+	case r.clicks <- click:
+	default:
+		r.log.Warn("click queue is full, dropping click", slog.String("alias", click.Alias))
+	}
+}
+
+// Run saves queued clicks in batches until ctx is cancelled, then saves what is left
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]database.Click, 0, batchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := r.saver.SaveClicks(batch); err != nil {
+			r.log.Error("failed to save clicks", slog.Int("count", len(batch)), slogg.Err(err))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case click := <-r.clicks:
+					batch = append(batch, click)
+					if len(batch) == batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		case click := <-r.clicks:
+			batch = append(batch, click)
+			if len(batch) == batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
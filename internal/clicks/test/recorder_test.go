@@ -0,0 +1,37 @@
+package clickstests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/clicks"
+	"github.com/FacelessWayfarer/urlshortner/internal/database"
+	"github.com/FacelessWayfarer/urlshortner/internal/database/memory"
+	discardslogg "github.com/FacelessWayfarer/urlshortner/internal/lib/discard-slogg"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRunFlushesOnStop checks clicks queued before shutdown are not lost
+func TestRunFlushesOnStop(t *testing.T) {
+	db := memory.New()
+
+	_, err := db.SaveURL(database.Link{URL: "https://google.com", Alias: "google"})
+	require.NoError(t, err)
+
+	recorder := clicks.NewRecorder(discardslogg.NewDiscardLogger(), db)
+
+	const total = 250
+	for i := 0; i < total; i++ {
+		recorder.Record(database.Click{Alias: "google", ClickedAt: time.Now()})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	recorder.Run(ctx)
+
+	stats, err := db.GetStats("google", time.Now().Add(-time.Hour), time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, int64(total), stats.Total)
+}
@@ -11,10 +11,76 @@ import (
 	"github.com/joho/godotenv"
 )
 
+// supported storage drivers
+const (
+	StorageSQLite   = "sqlite"
+	StoragePostgres = "postgres"
+	StorageMemory   = "memory"
+)
+
 type Cfg struct {
 	Env          string `yaml:"env" env:"ENV" env-deafault:"local"`
-	DatabasePath string `yaml:"database_path"  env-required:"true"`
-	HTTPServ     `yaml:"http_server"`
+	Storage      string `yaml:"storage" env:"STORAGE" env-default:"sqlite"`
+	DatabasePath string `yaml:"database_path"`
+	PostgresDSN  string `yaml:"postgres_dsn" env:"POSTGRES_DSN"`
+	// JanitorInterval is how often expired urls are purged, 0 disables the janitor
+	JanitorInterval time.Duration `yaml:"janitor_interval" env:"JANITOR_INTERVAL" env-default:"10m"`
+	Alias           Alias         `yaml:"alias"`
+	// Dedup reuses the generated alias of a url saved before instead of generating another one
+	Dedup bool `yaml:"dedup" env:"DEDUP" env-default:"false"`
+	// CaseInsensitiveAliases treats aliases that differ only in case as the same alias, sqlite storage only.
+	// Startup fails listing the clashing aliases when saved ones already differ only in case.
+	CaseInsensitiveAliases bool `yaml:"case_insensitive_aliases" env:"CASE_INSENSITIVE_ALIASES" env-default:"false"`
+	// StripTrackingParams drops utm_* and click id parameters from urls before they are stored
+	StripTrackingParams bool      `yaml:"strip_tracking_params" env:"STRIP_TRACKING_PARAMS" env-default:"false"`
+	URLPolicy           URLPolicy `yaml:"url_policy"`
+	// PublicHosts are the hosts short links are served on, destinations that are short links on them get flattened
+	PublicHosts []string `yaml:"public_hosts" env:"PUBLIC_HOSTS"`
+	// RedirectCode is the HTTP status links saved without their own redirect with: 301, 302, 303, 307 or 308
+	RedirectCode int `yaml:"redirect_code" env:"REDIRECT_CODE" env-default:"302"`
+	// MaxRedirectDepth is how many of our own short links may be followed for one destination
+	MaxRedirectDepth int          `yaml:"max_redirect_depth" env:"MAX_REDIRECT_DEPTH" env-default:"5"`
+	LinkPassword     LinkPassword `yaml:"link_password"`
+	NotYetActive     NotYetActive `yaml:"not_yet_active"`
+	HTTPServ         `yaml:"http_server"`
+}
+
+// LinkPassword throttles guesses of the passwords protected links ask for
+type LinkPassword struct {
+	// MaxAttempts guesses are allowed per alias within AttemptWindow, counted from the first one
+	MaxAttempts   int           `yaml:"max_attempts" env:"LINK_PASSWORD_MAX_ATTEMPTS" env-default:"5"`
+	AttemptWindow time.Duration `yaml:"attempt_window" env:"LINK_PASSWORD_ATTEMPT_WINDOW" env-default:"15m"`
+}
+
+// Alias selects how aliases are generated for links saved without one
+type Alias struct {
+	Strategy string `yaml:"strategy" env:"ALIAS_STRATEGY" env-default:"random"` // random, sequential or words
+	Length   int    `yaml:"length" env:"ALIAS_LENGTH" env-default:"5"`          // random aliases
+	Alphabet string `yaml:"alphabet" env:"ALIAS_ALPHABET"`                      // random aliases, look-alike characters are left out by default
+	Words    int    `yaml:"words" env:"ALIAS_WORDS" env-default:"3"`            // word aliases
+
+	// MinLength, MaxLength and Reserved limit aliases chosen by clients,
+	// first segments of the service's own routes are always reserved
+	MinLength int      `yaml:"min_length" env:"ALIAS_MIN_LENGTH" env-default:"3"`
+	MaxLength int      `yaml:"max_length" env:"ALIAS_MAX_LENGTH" env-default:"64"`
+	Reserved  []string `yaml:"reserved" env:"ALIAS_RESERVED" env-default:"admin,api,health,metrics,static"`
+}
+
+// URLPolicy limits where links may point, it is checked on save and again before every redirect
+type URLPolicy struct {
+	Schemes []string `yaml:"schemes" env:"URL_POLICY_SCHEMES" env-default:"http,https"`
+	// AllowList and DenyList are files with one domain per line, "*.example.com" matches its subdomains
+	AllowList       string `yaml:"allow_list" env:"URL_POLICY_ALLOW_LIST"`
+	DenyList        string `yaml:"deny_list" env:"URL_POLICY_DENY_LIST"`
+	BlockPrivateIPs bool   `yaml:"block_private_ips" env:"URL_POLICY_BLOCK_PRIVATE_IPS" env-default:"true"`
+}
+
+// NotYetActive is the answer to links visited before their active_from
+type NotYetActive struct {
+	Status  int    `yaml:"status" env:"NOT_YET_ACTIVE_STATUS" env-default:"404"` // a 4xx or 5xx status
+	Message string `yaml:"message" env:"NOT_YET_ACTIVE_MESSAGE" env-default:"not yet available"`
+	// RedirectURL sends visitors to a page like "coming soon" instead, the status and message are unused then
+	RedirectURL string `yaml:"redirect_url" env:"NOT_YET_ACTIVE_REDIRECT_URL"`
 }
 
 type HTTPServ struct {
@@ -23,6 +89,8 @@ type HTTPServ struct {
 	IdleTimeout time.Duration `yaml:"idle_timeout"  env-deafault:"60s"`
 	User        string        `yaml:"user" env-required:"true"`
 	Password    string        `yaml:"password" env-required:"true" env:"HTTP_SERVER_PASSWORD"`
+	// LegacyStatusCodes sends every JSON response with 200 for clients that read only the status field
+	LegacyStatusCodes bool `yaml:"legacy_status_codes" env:"HTTP_SERVER_LEGACY_STATUS_CODES" env-default:"false"`
 }
 
 func MustLoad() *Cfg {
@@ -43,5 +111,33 @@ func MustLoad() *Cfg {
 		log.Fatalf("cannot read config: %s", err)
 	}
 
+	switch cfg.Storage {
+	case StorageSQLite:
+		if cfg.DatabasePath == "" {
+			log.Fatal("database_path is required for sqlite storage")
+		}
+	case StoragePostgres:
+		if cfg.PostgresDSN == "" {
+			log.Fatal("postgres_dsn is required for postgres storage")
+		}
+	case StorageMemory:
+	default:
+		log.Fatalf("unknown storage driver %q", cfg.Storage)
+	}
+
+	switch cfg.RedirectCode {
+	case 301, 302, 303, 307, 308:
+	default:
+		log.Fatalf("redirect_code must be 301, 302, 303, 307 or 308, not %d", cfg.RedirectCode)
+	}
+
+	if cfg.NotYetActive.Status < 400 || cfg.NotYetActive.Status > 599 {
+		log.Fatalf("not_yet_active.status must be a 4xx or 5xx status, not %d", cfg.NotYetActive.Status)
+	}
+
+	if cfg.CaseInsensitiveAliases && cfg.Storage != StorageSQLite {
+		log.Fatalf("case_insensitive_aliases is supported by sqlite storage only, not %q", cfg.Storage)
+	}
+
 	return &cfg
 }
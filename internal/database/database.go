@@ -1,8 +1,160 @@
 package database
 
-import "errors"
+import (
+	"errors"
+	"maps"
+	"time"
+)
 
 var (
 	ErrURLNotFound      = errors.New("url not found")
 	ErrURLAlreadyExists = errors.New("url already exists")
+	// ErrAliasExhausted means every generated alias was taken, see AliasAttempts
+	ErrAliasExhausted = errors.New("no free alias generated")
+	// ErrAliasRejected is returned by an AliasFunc for an alias that must not be used,
+	// the storage moves on to the next attempt as if the alias were taken
+	ErrAliasRejected = errors.New("generated alias rejected")
+	// ErrNoVisitsLeft means a link with limited visits was used up, see Storage.UseVisit
+	ErrNoVisitsLeft = errors.New("no visits left")
 )
+
+// AliasAttempts is how many generated aliases a link tries before saving fails with ErrAliasExhausted
+const AliasAttempts = 10
+
+// Link is a saved url and everything stored alongside it
+type Link struct {
+	ID        int64
+	Alias     string
+	URL       string
+	CreatedAt time.Time  // set by the storage, zero for links saved before it was tracked
+	ExpiresAt *time.Time // nil for links that never expire
+	// ActiveFrom is when the link starts redirecting, nil for links active since they were saved
+	ActiveFrom *time.Time
+	Generated  bool // the alias was generated, not chosen by the client
+	// RedirectCode is the HTTP status the link redirects with, zero means the server default
+	RedirectCode int
+	// ForwardQuery merges the query of the short link request into the destination
+	ForwardQuery bool
+	// ForwardPath appends path segments after the alias to the destination
+	ForwardPath bool
+	// Params are query parameter templates added to the destination on redirect, see package utm
+	Params map[string]string
+	// PasswordHash gates the link behind a password, see package linklock. Empty for open links.
+	PasswordHash string
+	// VisitsLeft is how many more redirects the link serves, nil for links without a limit
+	VisitsLeft *int
+}
+
+// Active reports whether the link has started redirecting at the given moment, expiry is not checked
+func (l Link) Active(now time.Time) bool {
+	return l.ActiveFrom == nil || !now.Before(*l.ActiveFrom)
+}
+
+// UsedUp reports whether the link has a visit limit and no visits left
+func (l Link) UsedUp() bool {
+	return l.VisitsLeft != nil && *l.VisitsLeft <= 0
+}
+
+// Expired reports whether the link stopped working at the given moment
+func (l Link) Expired(now time.Time) bool {
+	return l.ExpiresAt != nil && !now.Before(*l.ExpiresAt)
+}
+
+// SameOptions reports whether both links redirect the same way, deduplication reuses only such links
+func (l Link) SameOptions(other Link) bool {
+	return l.RedirectCode == other.RedirectCode &&
+		l.ForwardQuery == other.ForwardQuery &&
+		l.ForwardPath == other.ForwardPath &&
+		maps.Equal(l.Params, other.Params) &&
+		l.PasswordHash == other.PasswordHash
+}
+
+// AliasFunc makes the alias of a link from the row id it is saved under,
+// attempt counts the aliases already found taken or rejected for the link
+type AliasFunc func(id int64, attempt int) (string, error)
+
+// SaveResult is the outcome of a single link passed to SaveURLs
+type SaveResult struct {
+	ID    int64
+	Alias string
+	Err   error // wraps ErrURLAlreadyExists when the alias is taken
+}
+
+// ListFilter narrows and pages ListURLs results.
+// Ids grow with creation time, so links are ordered by id and the id of the last link on a page is the cursor.
+type ListFilter struct {
+	AliasPrefix string
+	URLContains string
+	Desc        bool  // newest first
+	Cursor      int64 // id of the last link of the previous page, 0 for the first page
+	Limit       int
+}
+
+// HistoryEntry is a url an alias pointed to before it was retargeted
+type HistoryEntry struct {
+	URL        string
+	ReplacedAt time.Time
+}
+
+// Click is a single redirect served for an alias
+type Click struct {
+	Alias     string
+	ClickedAt time.Time
+	Referrer  string
+	UserAgent string
+	RequestID string
+}
+
+// Stats are click counts of an alias
+type Stats struct {
+	Total   int64    // all clicks ever recorded
+	Buckets []Bucket // clicks since the requested moment, oldest first, empty buckets are omitted
+}
+
+type Bucket struct {
+	Start time.Time
+	Count int64
+}
+
+// BucketStart truncates t to the start of its bucket the same way every backend does,
+// buckets are aligned to the unix epoch.
+func BucketStart(t time.Time, bucket time.Duration) time.Time {
+	size := int64(bucket / time.Second)
+	sec := t.Unix()
+
+	return time.Unix(sec-sec%size, 0).UTC()
+}
+
+// Storage is the contract every database backend implements.
+// Handlers still declare the narrow part of it they use.
+type Storage interface {
+	SaveURL(link Link) (int64, error)
+	// SaveGeneratedURL saves link under the alias newAlias makes from its row id, link.Alias is ignored.
+	// Taken aliases are retried on the unique constraint, the returned link has its id, alias and creation time set.
+	SaveGeneratedURL(link Link, newAlias AliasFunc) (Link, error)
+	// FindOrSaveGeneratedURL returns the generated link without expiry already saved for link.URL,
+	// or saves link like SaveGeneratedURL when there is none. Links with an expiry, an activation time or a visit limit are never reused.
+	FindOrSaveGeneratedURL(link Link, newAlias AliasFunc) (saved Link, found bool, err error)
+	// SaveURLs saves links in one transaction, a taken alias fails only its own link.
+	// Links without an alias get one from newAlias the way SaveGeneratedURL does, newAlias may be nil when every link has one.
+	// Results are in the order of links, err is set when nothing was saved.
+	SaveURLs(links []Link, newAlias AliasFunc) ([]SaveResult, error)
+	GetURL(alias string) (Link, error)
+	// UseVisit takes one of the visits left of a link with a visit limit in a single step,
+	// so concurrent visits never take more than there are. It returns ErrNoVisitsLeft when
+	// none are left or the link is gone, links without a limit must not be passed.
+	UseVisit(alias string) error
+	// DeleteURL returns ErrURLNotFound when there was nothing to remove
+	DeleteURL(alias string) error
+	// ListURLs returns at most filter.Limit links matching the filter, matching is case sensitive
+	ListURLs(filter ListFilter) ([]Link, error)
+	// UpdateURL retargets an alias and records the previous url in its history
+	UpdateURL(alias, url string) (previous string, err error)
+	// GetHistory lists previous urls of an existing alias, newest first
+	GetHistory(alias string) ([]HistoryEntry, error)
+	// DeleteExpired removes links expired at the given moment and returns how many were removed
+	DeleteExpired(now time.Time) (int64, error)
+	SaveClicks(clicks []Click) error
+	// GetStats counts clicks of an existing alias, buckets start at since and are bucket long
+	GetStats(alias string, since time.Time, bucket time.Duration) (Stats, error)
+}
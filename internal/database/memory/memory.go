@@ -0,0 +1,372 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/database"
+)
+
+var _ database.Storage = (*Database)(nil)
+
+// Database keeps urls in a map guarded by a mutex, nothing survives a restart
+type Database struct {
+	mu      sync.RWMutex
+	lastID  int64
+	urls    map[string]database.Link
+	clicks  map[string][]database.Click
+	history map[string][]database.HistoryEntry // oldest first
+}
+
+func New() *Database {
+	return &Database{
+		urls:    make(map[string]database.Link),
+		clicks:  make(map[string][]database.Click),
+		history: make(map[string][]database.HistoryEntry),
+	}
+}
+
+func (d *Database) SaveURL(link database.Link) (int64, error) {
+	const mark = "database.memory.SaveURL"
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.urls[link.Alias]; ok {
+		return 0, fmt.Errorf("%s: %w", mark, database.ErrURLAlreadyExists)
+	}
+
+	d.lastID++
+	link.ID = d.lastID
+	link.CreatedAt = time.Now().UTC()
+	link = detach(link)
+	d.urls[link.Alias] = link
+
+	return d.lastID, nil
+}
+
+func (d *Database) SaveGeneratedURL(link database.Link, newAlias database.AliasFunc) (database.Link, error) {
+	const mark = "database.memory.SaveGeneratedURL"
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	link.CreatedAt = time.Now().UTC()
+
+	link, err := d.insertGenerated(link, newAlias)
+	if err != nil {
+		return database.Link{}, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	link = detach(link)
+
+	return link, nil
+}
+
+func (d *Database) FindOrSaveGeneratedURL(link database.Link, newAlias database.AliasFunc) (database.Link, bool, error) {
+	const mark = "database.memory.FindOrSaveGeneratedURL"
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if link.ExpiresAt == nil && link.ActiveFrom == nil && link.VisitsLeft == nil {
+		var (
+			existing database.Link
+			found    bool
+		)
+		for _, l := range d.urls {
+			if l.Generated && l.ExpiresAt == nil && l.ActiveFrom == nil && l.VisitsLeft == nil && l.URL == link.URL && l.SameOptions(link) && (!found || l.ID < existing.ID) {
+				existing, found = l, true
+			}
+		}
+		if found {
+			return existing, true, nil
+		}
+	}
+
+	link.CreatedAt = time.Now().UTC()
+
+	link, err := d.insertGenerated(link, newAlias)
+	if err != nil {
+		return database.Link{}, false, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	link = detach(link)
+
+	return link, false, nil
+}
+
+func (d *Database) SaveURLs(links []database.Link, newAlias database.AliasFunc) ([]database.SaveResult, error) {
+	const mark = "database.memory.SaveURLs"
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	results := make([]database.SaveResult, len(links))
+
+	now := time.Now().UTC()
+	for i, link := range links {
+		link.CreatedAt = now
+
+		if link.Alias == "" && newAlias != nil {
+			saved, err := d.insertGenerated(link, newAlias)
+			if errors.Is(err, database.ErrAliasExhausted) {
+				results[i].Err = fmt.Errorf("%s: %w", mark, err)
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s:%w", mark, err)
+			}
+			results[i].ID, results[i].Alias = saved.ID, saved.Alias
+			continue
+		}
+		results[i].Alias = link.Alias
+
+		if _, ok := d.urls[link.Alias]; ok {
+			results[i].Err = fmt.Errorf("%s: %w", mark, database.ErrURLAlreadyExists)
+			continue
+		}
+
+		d.lastID++
+		link.ID = d.lastID
+		link = detach(link)
+		d.urls[link.Alias] = link
+
+		results[i].ID = link.ID
+	}
+
+	return results, nil
+}
+
+// insertGenerated stores link under the first free alias newAlias makes, d.mu must be held
+func (d *Database) insertGenerated(link database.Link, newAlias database.AliasFunc) (database.Link, error) {
+	for attempt := 0; attempt < database.AliasAttempts; attempt++ {
+		// the id moves on with every attempt so id based aliases change too
+		id := d.lastID + 1 + int64(attempt)
+
+		alias, err := newAlias(id, attempt)
+		if errors.Is(err, database.ErrAliasRejected) {
+			continue
+		}
+		if err != nil {
+			return database.Link{}, err
+		}
+		if _, ok := d.urls[alias]; ok {
+			continue
+		}
+
+		d.lastID = id
+		link.ID = id
+		link.Alias = alias
+		link.Generated = true
+		link = detach(link)
+		d.urls[alias] = link
+
+		return link, nil
+	}
+
+	return database.Link{}, database.ErrAliasExhausted
+}
+
+func (d *Database) GetURL(alias string) (database.Link, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	link, ok := d.urls[alias]
+	if !ok {
+		return database.Link{}, database.ErrURLNotFound
+	}
+
+	link = detach(link)
+
+	return link, nil
+}
+
+func (d *Database) UseVisit(alias string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	link, ok := d.urls[alias]
+	if !ok || link.VisitsLeft == nil || *link.VisitsLeft <= 0 {
+		return database.ErrNoVisitsLeft
+	}
+
+	left := *link.VisitsLeft - 1
+	link.VisitsLeft = &left
+	d.urls[alias] = link
+
+	return nil
+}
+
+func (d *Database) ListURLs(filter database.ListFilter) ([]database.Link, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var links []database.Link
+	for _, link := range d.urls {
+		switch {
+		case !strings.HasPrefix(link.Alias, filter.AliasPrefix),
+			!strings.Contains(link.URL, filter.URLContains),
+			filter.Cursor != 0 && filter.Desc && link.ID >= filter.Cursor,
+			filter.Cursor != 0 && !filter.Desc && link.ID <= filter.Cursor:
+			continue
+		}
+		link = detach(link)
+		links = append(links, link)
+	}
+
+	sort.Slice(links, func(i, j int) bool {
+		if filter.Desc {
+			return links[i].ID > links[j].ID
+		}
+		return links[i].ID < links[j].ID
+	})
+
+	if len(links) > filter.Limit {
+		links = links[:filter.Limit]
+	}
+
+	return links, nil
+}
+
+func (d *Database) DeleteURL(alias string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.urls[alias]; !ok {
+		return database.ErrURLNotFound
+	}
+
+	d.deleteAlias(alias)
+
+	return nil
+}
+
+func (d *Database) DeleteExpired(now time.Time) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var n int64
+	for alias, link := range d.urls {
+		if link.Expired(now) {
+			d.deleteAlias(alias)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// deleteAlias removes the url and everything recorded for it, d.mu must be held
+func (d *Database) deleteAlias(alias string) {
+	delete(d.urls, alias)
+	delete(d.clicks, alias)
+	delete(d.history, alias)
+}
+
+func (d *Database) UpdateURL(alias, url string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	link, ok := d.urls[alias]
+	if !ok {
+		return "", database.ErrURLNotFound
+	}
+
+	previous := link.URL
+	d.history[alias] = append(d.history[alias], database.HistoryEntry{
+		URL:        previous,
+		ReplacedAt: time.Now().UTC(),
+	})
+
+	link.URL = url
+	d.urls[alias] = link
+
+	return previous, nil
+}
+
+func (d *Database) GetHistory(alias string) ([]database.HistoryEntry, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if _, ok := d.urls[alias]; !ok {
+		return nil, database.ErrURLNotFound
+	}
+
+	stored := d.history[alias]
+
+	var history []database.HistoryEntry
+	for i := len(stored) - 1; i >= 0; i-- {
+		history = append(history, stored[i])
+	}
+
+	return history, nil
+}
+
+func (d *Database) SaveClicks(clicks []database.Click) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, c := range clicks {
+		// the sql backends keep second precision
+		c.ClickedAt = time.Unix(c.ClickedAt.Unix(), 0).UTC()
+		d.clicks[c.Alias] = append(d.clicks[c.Alias], c)
+	}
+
+	return nil
+}
+
+func (d *Database) GetStats(alias string, since time.Time, bucket time.Duration) (database.Stats, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if _, ok := d.urls[alias]; !ok {
+		return database.Stats{}, database.ErrURLNotFound
+	}
+
+	clicks := d.clicks[alias]
+	from := database.BucketStart(since, bucket)
+
+	counts := make(map[time.Time]int64)
+	for _, c := range clicks {
+		if c.ClickedAt.Before(from) {
+			continue
+		}
+		counts[database.BucketStart(c.ClickedAt, bucket)]++
+	}
+
+	stats := database.Stats{Total: int64(len(clicks))}
+	for start, count := range counts {
+		stats.Buckets = append(stats.Buckets, database.Bucket{Start: start, Count: count})
+	}
+	sort.Slice(stats.Buckets, func(i, j int) bool { return stats.Buckets[i].Start.Before(stats.Buckets[j].Start) })
+
+	return stats, nil
+}
+
+// detach keeps callers from mutating stored links through shared pointers
+func detach(link database.Link) database.Link {
+	link.ExpiresAt = copyTime(link.ExpiresAt)
+	link.ActiveFrom = copyTime(link.ActiveFrom)
+	if link.VisitsLeft != nil {
+		left := *link.VisitsLeft
+		link.VisitsLeft = &left
+	}
+
+	return link
+}
+
+// copyTime keeps times in UTC like the sql backends return them
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	v := t.UTC()
+
+	return &v
+}
@@ -0,0 +1,15 @@
+package memorytests
+
+import (
+	"testing"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/database"
+	"github.com/FacelessWayfarer/urlshortner/internal/database/memory"
+	"github.com/FacelessWayfarer/urlshortner/internal/database/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) database.Storage {
+		return memory.New()
+	})
+}
@@ -0,0 +1,318 @@
+// Package migrate applies versioned schema migrations embedded into the sql backends.
+//
+// Migrations are pairs of files named <version>_<name>.up.sql and <version>_<name>.down.sql,
+// applied versions are recorded in the schema_version table.
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidMigration = errors.New("invalid migration")
+	ErrUnknownVersion   = errors.New("database has a schema version unknown to this build")
+)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status of a single migration as seen in the database
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// Load reads every *.sql file in the root of fsys
+func Load(fsys fs.FS) ([]Migration, error) {
+	const mark = "database.migrate.Load"
+
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	byVersion := make(map[int]*Migration)
+
+	for _, file := range files {
+		base := path.Base(file)
+
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("%s: %w: %s: expected .up.sql or .down.sql", mark, ErrInvalidMigration, base)
+		}
+
+		versionStr, name, ok := strings.Cut(strings.TrimSuffix(base, "."+direction+".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("%s: %w: %s: expected <version>_<name>", mark, ErrInvalidMigration, base)
+		}
+
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("%s: %w: %s: bad version", mark, ErrInvalidMigration, base)
+		}
+
+		body, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%w", mark, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("%s: %w: version %d is used by %s and %s", mark, ErrInvalidMigration, version, m.Name, name)
+		}
+
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("%s: %w: version %d needs both up and down files", mark, ErrInvalidMigration, m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// MustLoad loads the migrations from dir of fsys and panics on error,
+// it is meant for migrations embedded into the binary
+func MustLoad(fsys fs.FS, dir string) []Migration {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+
+	migrations, err := Load(sub)
+	if err != nil {
+		panic(err)
+	}
+
+	return migrations
+}
+
+func New(db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}
+}
+
+func (m *Migrator) init() error {
+	_, err := m.db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_version(
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL);
+	`)
+
+	return err
+}
+
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	rows, err := m.db.Query("SELECT version, applied_at FROM schema_version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// Version returns the latest applied version, 0 for an empty database
+func (m *Migrator) Version() (int, error) {
+	const mark = "database.migrate.Version"
+
+	if err := m.init(); err != nil {
+		return 0, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	var version sql.NullInt64
+	if err := m.db.QueryRow("SELECT MAX(version) FROM schema_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return int(version.Int64), nil
+}
+
+func (m *Migrator) Status() ([]Status, error) {
+	const mark = "database.migrate.Status"
+
+	if err := m.init(); err != nil {
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		appliedAt, ok := applied[migration.Version]
+		statuses = append(statuses, Status{
+			Migration: migration,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		})
+	}
+
+	return statuses, nil
+}
+
+// Up applies every pending migration in order and returns the applied ones
+func (m *Migrator) Up() ([]Migration, error) {
+	const mark = "database.migrate.Up"
+
+	if err := m.init(); err != nil {
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	if err := m.checkKnown(applied); err != nil {
+		return nil, fmt.Errorf("%s: %w", mark, err)
+	}
+
+	var done []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		err := m.inTx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(migration.Up); err != nil {
+				return err
+			}
+			_, err := tx.Exec("INSERT INTO schema_version(version, name, applied_at) VALUES($1, $2, $3)",
+				migration.Version, migration.Name, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("%s: migration %d_%s: %w", mark, migration.Version, migration.Name, err)
+		}
+
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Down rolls back the last steps applied migrations and returns the rolled back ones
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	const mark = "database.migrate.Down"
+
+	if err := m.init(); err != nil {
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	if err := m.checkKnown(applied); err != nil {
+		return nil, fmt.Errorf("%s: %w", mark, err)
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		err := m.inTx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(migration.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec("DELETE FROM schema_version WHERE version = $1", migration.Version)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("%s: migration %d_%s: %w", mark, migration.Version, migration.Name, err)
+		}
+
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// checkKnown refuses to touch a database migrated by a newer build
+func (m *Migrator) checkKnown(applied map[int]time.Time) error {
+	known := make(map[int]struct{}, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = struct{}{}
+	}
+
+	for version := range applied {
+		if _, ok := known[version]; !ok {
+			return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,150 @@
+package migratetests
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/database/migrate"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+var testMigrations = fstest.MapFS{
+	"0001_create_a.up.sql":   {Data: []byte("CREATE TABLE a(id INTEGER PRIMARY KEY);")},
+	"0001_create_a.down.sql": {Data: []byte("DROP TABLE a;")},
+	"0002_add_name.up.sql":   {Data: []byte("ALTER TABLE a ADD COLUMN name TEXT;")},
+	"0002_add_name.down.sql": {Data: []byte("ALTER TABLE a DROP COLUMN name;")},
+}
+
+func openDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "database.db"))
+	require.NoError(t, err)
+
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := migrate.Load(testMigrations)
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+
+	require.Equal(t, 1, migrations[0].Version)
+	require.Equal(t, "create_a", migrations[0].Name)
+	require.Equal(t, 2, migrations[1].Version)
+	require.Equal(t, "add_name", migrations[1].Name)
+}
+
+func TestLoadInvalid(t *testing.T) {
+	cases := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{
+			name:  "Missing down",
+			files: fstest.MapFS{"0001_a.up.sql": {Data: []byte("SELECT 1;")}},
+		},
+		{
+			name:  "Bad version",
+			files: fstest.MapFS{"first_a.up.sql": {Data: []byte("SELECT 1;")}},
+		},
+		{
+			name:  "Bad suffix",
+			files: fstest.MapFS{"0001_a.sql": {Data: []byte("SELECT 1;")}},
+		},
+		{
+			name: "Name mismatch",
+			files: fstest.MapFS{
+				"0001_a.up.sql":   {Data: []byte("SELECT 1;")},
+				"0001_b.down.sql": {Data: []byte("SELECT 1;")},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := migrate.Load(tc.files)
+			require.ErrorIs(t, err, migrate.ErrInvalidMigration)
+		})
+	}
+}
+
+func TestUpDown(t *testing.T) {
+	db := openDB(t)
+
+	migrations, err := migrate.Load(testMigrations)
+	require.NoError(t, err)
+
+	m := migrate.New(db, migrations)
+
+	applied, err := m.Up()
+	require.NoError(t, err)
+	require.Len(t, applied, 2)
+
+	version, err := m.Version()
+	require.NoError(t, err)
+	require.Equal(t, 2, version)
+
+	_, err = db.Exec("INSERT INTO a(id, name) VALUES(1, 'one')")
+	require.NoError(t, err)
+
+	applied, err = m.Up()
+	require.NoError(t, err)
+	require.Empty(t, applied, "up must be idempotent")
+
+	reverted, err := m.Down(1)
+	require.NoError(t, err)
+	require.Len(t, reverted, 1)
+	require.Equal(t, 2, reverted[0].Version)
+
+	statuses, err := m.Status()
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	require.True(t, statuses[0].Applied)
+	require.False(t, statuses[0].AppliedAt.IsZero())
+	require.False(t, statuses[1].Applied)
+
+	reverted, err = m.Down(5)
+	require.NoError(t, err)
+	require.Len(t, reverted, 1)
+
+	version, err = m.Version()
+	require.NoError(t, err)
+	require.Zero(t, version)
+}
+
+func TestFailedMigrationIsRolledBack(t *testing.T) {
+	db := openDB(t)
+
+	m := migrate.New(db, []migrate.Migration{
+		{Version: 1, Name: "broken", Up: "CREATE TABLE a(id INTEGER); SELECT * FROM missing;", Down: "DROP TABLE a;"},
+	})
+
+	_, err := m.Up()
+	require.Error(t, err)
+
+	version, err := m.Version()
+	require.NoError(t, err)
+	require.Zero(t, version)
+
+	_, err = db.Exec("SELECT * FROM a")
+	require.Error(t, err, "partial migration must not be left behind")
+}
+
+func TestUnknownVersion(t *testing.T) {
+	db := openDB(t)
+
+	migrations, err := migrate.Load(testMigrations)
+	require.NoError(t, err)
+
+	_, err = migrate.New(db, migrations).Up()
+	require.NoError(t, err)
+
+	// an older build only knows about the first migration
+	_, err = migrate.New(db, migrations[:1]).Up()
+	require.ErrorIs(t, err, migrate.ErrUnknownVersion)
+}
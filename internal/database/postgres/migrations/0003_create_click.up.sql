@@ -0,0 +1,9 @@
+-- clicked_at is unix seconds so stats buckets are computed with plain integer math
+CREATE TABLE IF NOT EXISTS click(
+	id BIGSERIAL PRIMARY KEY,
+	alias TEXT NOT NULL,
+	clicked_at BIGINT NOT NULL,
+	referrer TEXT NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT '',
+	request_id TEXT NOT NULL DEFAULT '');
+CREATE INDEX IF NOT EXISTS idx_click_alias_clicked_at ON click(alias, clicked_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_url_history_alias;
+DROP TABLE IF EXISTS url_history;
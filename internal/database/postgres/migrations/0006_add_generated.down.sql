@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_url;
+ALTER TABLE url DROP COLUMN IF EXISTS generated;
@@ -0,0 +1,3 @@
+-- links saved before this migration count as custom ones and are never reused by deduplication
+ALTER TABLE url ADD COLUMN IF NOT EXISTS generated BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX IF NOT EXISTS idx_url ON url(url);
@@ -0,0 +1,3 @@
+-- both default to the old behaviour of redirecting to the stored url as is
+ALTER TABLE url ADD COLUMN IF NOT EXISTS forward_query BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE url ADD COLUMN IF NOT EXISTS forward_path BOOLEAN NOT NULL DEFAULT FALSE;
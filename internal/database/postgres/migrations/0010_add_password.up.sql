@@ -0,0 +1,2 @@
+-- bcrypt hash of the password gating the link, empty for open links
+ALTER TABLE url ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT '';
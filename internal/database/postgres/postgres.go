@@ -0,0 +1,609 @@
+package postgres
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/database"
+	"github.com/FacelessWayfarer/urlshortner/internal/database/migrate"
+	"github.com/FacelessWayfarer/urlshortner/internal/database/sqlnull"
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// uniqueViolation is the SQLSTATE postgres reports when a UNIQUE constraint is broken
+const uniqueViolation = "23505"
+
+var _ database.Storage = (*Database)(nil)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+var schema = migrate.MustLoad(migrations, "migrations")
+
+// aliasTables hold rows that belong to an alias and go away together with it
+var aliasTables = []string{"click", "url_history"}
+
+type Database struct {
+	db *sql.DB
+}
+
+// New connects to the database and applies every pending migration
+func New(dsn string) (*Database, error) {
+	const mark = "database.postgres.New"
+
+	d, err := Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := d.Migrator().Up(); err != nil {
+		_ = d.Close()
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return d, nil
+}
+
+// Open connects to the database without touching its schema
+func Open(dsn string) (*Database, error) {
+	const mark = "database.postgres.Open"
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return &Database{db: db}, nil
+}
+
+// Migrator manages the schema of the database with the migrations embedded into the binary
+func (d *Database) Migrator() *migrate.Migrator {
+	return migrate.New(d.db, schema)
+}
+
+func (d *Database) SaveURL(link database.Link) (int64, error) {
+	const mark = "database.postgres.SaveURL"
+
+	var id int64
+
+	link.CreatedAt = time.Now().UTC()
+
+	err := d.db.QueryRow("INSERT INTO url("+linkFields+") VALUES("+linkPlaceholders(1)+") RETURNING id",
+		linkArgs(link)...).Scan(&id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s: %w", mark, database.ErrURLAlreadyExists)
+		}
+		return 0, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return id, nil
+}
+
+func (d *Database) SaveGeneratedURL(link database.Link, newAlias database.AliasFunc) (database.Link, error) {
+	const mark = "database.postgres.SaveGeneratedURL"
+
+	link.CreatedAt = time.Now().UTC()
+
+	link, err := insertGenerated(d.db, link, newAlias)
+	if err != nil {
+		return database.Link{}, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return link, nil
+}
+
+func (d *Database) FindOrSaveGeneratedURL(link database.Link, newAlias database.AliasFunc) (database.Link, bool, error) {
+	const mark = "database.postgres.FindOrSaveGeneratedURL"
+
+	link.CreatedAt = time.Now().UTC()
+
+	var found bool
+
+	err := d.inTx(func(tx *sql.Tx) error {
+		if link.ExpiresAt == nil && link.ActiveFrom == nil && link.VisitsLeft == nil {
+			// concurrent saves of one url wait for each other, otherwise both would miss and insert
+			if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", link.URL); err != nil {
+				return err
+			}
+
+			existing, err := scanLink(tx.QueryRow("SELECT "+linkColumns+` FROM url
+				WHERE url = $1 AND generated AND expires_at IS NULL AND active_from IS NULL AND visits_left IS NULL
+					AND redirect_code = $2 AND forward_query = $3 AND forward_path = $4 AND params = $5 AND password_hash = $6
+				ORDER BY id LIMIT 1`, link.URL, link.RedirectCode, link.ForwardQuery, link.ForwardPath,
+				sqlnull.FromParams(link.Params), link.PasswordHash))
+			if err == nil {
+				link, found = existing, true
+				return nil
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+		}
+
+		var err error
+		link, err = insertGenerated(tx, link, newAlias)
+		return err
+	})
+	if err != nil {
+		return database.Link{}, false, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return link, found, nil
+}
+
+func (d *Database) SaveURLs(links []database.Link, newAlias database.AliasFunc) ([]database.SaveResult, error) {
+	const mark = "database.postgres.SaveURLs"
+
+	results := make([]database.SaveResult, len(links))
+
+	// a failed statement aborts the whole postgres transaction, so conflicts are skipped instead of raised
+	err := d.inTx(func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare("INSERT INTO url(id, " + linkFields + ") VALUES($1, " + linkPlaceholders(2) + `)
+			ON CONFLICT (alias) DO NOTHING RETURNING id`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		now := time.Now().UTC()
+		for i, link := range links {
+			link.CreatedAt = now
+
+			if link.Alias == "" && newAlias != nil {
+				saved, err := insertGenerated(tx, link, newAlias)
+				if errors.Is(err, database.ErrAliasExhausted) {
+					results[i].Err = fmt.Errorf("%s: %w", mark, err)
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				results[i].ID, results[i].Alias = saved.ID, saved.Alias
+				continue
+			}
+			results[i].Alias = link.Alias
+
+			id, err := nextID(tx)
+			if err != nil {
+				return err
+			}
+
+			err = stmt.QueryRow(append([]any{id}, linkArgs(link)...)...).Scan(&results[i].ID)
+			if errors.Is(err, sql.ErrNoRows) {
+				results[i].Err = fmt.Errorf("%s: %w", mark, database.ErrURLAlreadyExists)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return results, nil
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// insertGenerated inserts link under the first free alias newAlias makes,
+// the unique constraint on alias is the only collision check
+func insertGenerated(q queryRower, link database.Link, newAlias database.AliasFunc) (database.Link, error) {
+	for attempt := 0; attempt < database.AliasAttempts; attempt++ {
+		id, err := nextID(q)
+		if err != nil {
+			return database.Link{}, err
+		}
+
+		link.Alias, err = newAlias(id, attempt)
+		if errors.Is(err, database.ErrAliasRejected) {
+			continue
+		}
+		if err != nil {
+			return database.Link{}, err
+		}
+
+		err = q.QueryRow("INSERT INTO url(id, generated, "+linkFields+") VALUES($1, TRUE, "+linkPlaceholders(2)+`)
+			ON CONFLICT (alias) DO NOTHING RETURNING id`,
+			append([]any{id}, linkArgs(link)...)...).Scan(&link.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return database.Link{}, err
+		}
+
+		link.Generated = true
+		return link, nil
+	}
+
+	return database.Link{}, database.ErrAliasExhausted
+}
+
+// nextID takes the id of the next url from the sequence, it is never handed out twice
+func nextID(q queryRower) (int64, error) {
+	var id int64
+	err := q.QueryRow("SELECT nextval(pg_get_serial_sequence('url', 'id'))").Scan(&id)
+	return id, err
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
+
+func (d *Database) GetURL(alias string) (database.Link, error) {
+	const mark = "database.postgres.GetURL"
+
+	link, err := scanLink(d.db.QueryRow("SELECT "+linkColumns+" FROM url WHERE alias = $1", alias))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.Link{}, database.ErrURLNotFound
+		}
+		return database.Link{}, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return link, nil
+}
+
+// UseVisit decrements the counter in one statement, concurrent visits can not drive it below zero
+func (d *Database) UseVisit(alias string) error {
+	const mark = "database.postgres.UseVisit"
+
+	res, err := d.db.Exec("UPDATE url SET visits_left = visits_left - 1 WHERE alias = $1 AND visits_left > 0", alias)
+	if err != nil {
+		return fmt.Errorf("%s:%w", mark, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s:%w", mark, err)
+	}
+	if n == 0 {
+		return database.ErrNoVisitsLeft
+	}
+
+	return nil
+}
+
+func (d *Database) ListURLs(filter database.ListFilter) ([]database.Link, error) {
+	const mark = "database.postgres.ListURLs"
+
+	var (
+		where []string
+		args  []any
+	)
+
+	// arg adds a query argument and returns its placeholder
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.AliasPrefix != "" {
+		where = append(where, fmt.Sprintf("starts_with(alias, %s)", arg(filter.AliasPrefix)))
+	}
+	if filter.URLContains != "" {
+		where = append(where, fmt.Sprintf("strpos(url, %s) > 0", arg(filter.URLContains)))
+	}
+
+	order := "ASC"
+	if filter.Desc {
+		order = "DESC"
+	}
+	if filter.Cursor != 0 {
+		if filter.Desc {
+			where = append(where, "id < "+arg(filter.Cursor))
+		} else {
+			where = append(where, "id > "+arg(filter.Cursor))
+		}
+	}
+
+	query := "SELECT " + linkColumns + " FROM url"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id " + order + " LIMIT " + arg(filter.Limit)
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+	defer rows.Close()
+
+	var links []database.Link
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%w", mark, err)
+		}
+		links = append(links, link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return links, nil
+}
+
+func (d *Database) DeleteURL(alias string) error {
+	const mark = "database.postgres.DeleteURL"
+
+	err := d.inTx(func(tx *sql.Tx) error {
+		for _, table := range aliasTables {
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE alias = $1", alias); err != nil {
+				return err
+			}
+		}
+		res, err := tx.Exec("DELETE FROM url WHERE alias = $1", alias)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return database.ErrURLNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, database.ErrURLNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s:%w", mark, err)
+	}
+	return nil
+}
+
+func (d *Database) DeleteExpired(now time.Time) (int64, error) {
+	const mark = "database.postgres.DeleteExpired"
+
+	var n int64
+
+	err := d.inTx(func(tx *sql.Tx) error {
+		for _, table := range aliasTables {
+			_, err := tx.Exec("DELETE FROM "+table+` WHERE alias IN (
+				SELECT alias FROM url WHERE expires_at IS NOT NULL AND expires_at <= $1)`, now.UTC())
+			if err != nil {
+				return err
+			}
+		}
+
+		rst, err := tx.Exec("DELETE FROM url WHERE expires_at IS NOT NULL AND expires_at <= $1", now.UTC())
+		if err != nil {
+			return err
+		}
+
+		n, err = rst.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return n, nil
+}
+
+func (d *Database) UpdateURL(alias, url string) (string, error) {
+	const mark = "database.postgres.UpdateURL"
+
+	var previous string
+
+	err := d.inTx(func(tx *sql.Tx) error {
+		err := tx.QueryRow("SELECT url FROM url WHERE alias = $1 FOR UPDATE", alias).Scan(&previous)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("INSERT INTO url_history(alias, url, replaced_at) VALUES($1,$2,$3)",
+			alias, previous, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE url SET url = $1 WHERE alias = $2", url, alias)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", database.ErrURLNotFound
+		}
+		return "", fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return previous, nil
+}
+
+func (d *Database) GetHistory(alias string) ([]database.HistoryEntry, error) {
+	const mark = "database.postgres.GetHistory"
+
+	var exists int
+	err := d.db.QueryRow("SELECT 1 FROM url WHERE alias = $1", alias).Scan(&exists)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, database.ErrURLNotFound
+		}
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	rows, err := d.db.Query("SELECT url, replaced_at FROM url_history WHERE alias = $1 ORDER BY id DESC", alias)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+	defer rows.Close()
+
+	var history []database.HistoryEntry
+	for rows.Next() {
+		var entry database.HistoryEntry
+		if err := rows.Scan(&entry.URL, &entry.ReplacedAt); err != nil {
+			return nil, fmt.Errorf("%s:%w", mark, err)
+		}
+		entry.ReplacedAt = entry.ReplacedAt.UTC()
+		history = append(history, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return history, nil
+}
+
+func (d *Database) SaveClicks(clicks []database.Click) error {
+	const mark = "database.postgres.SaveClicks"
+
+	err := d.inTx(func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(`INSERT INTO click(alias, clicked_at, referrer, user_agent, request_id)
+			VALUES($1,$2,$3,$4,$5)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, c := range clicks {
+			if _, err := stmt.Exec(c.Alias, c.ClickedAt.Unix(), c.Referrer, c.UserAgent, c.RequestID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return nil
+}
+
+func (d *Database) GetStats(alias string, since time.Time, bucket time.Duration) (database.Stats, error) {
+	const mark = "database.postgres.GetStats"
+
+	var exists int
+	err := d.db.QueryRow("SELECT 1 FROM url WHERE alias = $1", alias).Scan(&exists)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.Stats{}, database.ErrURLNotFound
+		}
+		return database.Stats{}, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	var stats database.Stats
+
+	err = d.db.QueryRow("SELECT COUNT(*) FROM click WHERE alias = $1", alias).Scan(&stats.Total)
+	if err != nil {
+		return database.Stats{}, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	size := int64(bucket / time.Second)
+
+	rows, err := d.db.Query(`SELECT clicked_at - clicked_at % $2 AS bucket, COUNT(*) FROM click
+		WHERE alias = $1 AND clicked_at >= $3
+		GROUP BY bucket ORDER BY bucket`, alias, size, database.BucketStart(since, bucket).Unix())
+	if err != nil {
+		return database.Stats{}, fmt.Errorf("%s:%w", mark, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			start int64
+			b     database.Bucket
+		)
+		if err := rows.Scan(&start, &b.Count); err != nil {
+			return database.Stats{}, fmt.Errorf("%s:%w", mark, err)
+		}
+		b.Start = time.Unix(start, 0).UTC()
+		stats.Buckets = append(stats.Buckets, b)
+	}
+	if err := rows.Err(); err != nil {
+		return database.Stats{}, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return stats, nil
+}
+
+// linkFields are the columns a new link is inserted with, linkArgs returns their values in this order
+const linkFields = "url, alias, created_at, expires_at, redirect_code, forward_query, forward_path, params, password_hash, visits_left, active_from"
+
+// linkPlaceholders numbers the placeholders of linkFields starting with $from
+func linkPlaceholders(from int) string {
+	placeholders := make([]string, strings.Count(linkFields, ",")+1)
+	for i := range placeholders {
+		placeholders[i] = "$" + strconv.Itoa(from+i)
+	}
+	return strings.Join(placeholders, ", ")
+}
+
+func linkArgs(link database.Link) []any {
+	return []any{
+		link.URL, link.Alias, link.CreatedAt, sqlnull.FromTime(link.ExpiresAt),
+		link.RedirectCode, link.ForwardQuery, link.ForwardPath, sqlnull.FromParams(link.Params),
+		link.PasswordHash, sqlnull.FromInt(link.VisitsLeft), sqlnull.FromTime(link.ActiveFrom),
+	}
+}
+
+// linkColumns are read by scanLink in this order
+const linkColumns = "id, alias, url, created_at, expires_at, generated, redirect_code, forward_query, forward_path, params, password_hash, visits_left, active_from"
+
+func scanLink(row interface{ Scan(dest ...any) error }) (database.Link, error) {
+	var (
+		link       database.Link
+		createdAt  sql.NullTime
+		expiresAt  sql.NullTime
+		params     string
+		visits     sql.NullInt64
+		activeFrom sql.NullTime
+	)
+
+	if err := row.Scan(&link.ID, &link.Alias, &link.URL, &createdAt, &expiresAt, &link.Generated,
+		&link.RedirectCode, &link.ForwardQuery, &link.ForwardPath, &params, &link.PasswordHash, &visits, &activeFrom); err != nil {
+		return database.Link{}, err
+	}
+
+	var err error
+	if link.Params, err = sqlnull.ToParams(params); err != nil {
+		return database.Link{}, err
+	}
+
+	link.CreatedAt = createdAt.Time.UTC()
+	link.ExpiresAt = sqlnull.ToTime(expiresAt)
+	link.VisitsLeft = sqlnull.ToInt(visits)
+	link.ActiveFrom = sqlnull.ToTime(activeFrom)
+
+	return link, nil
+}
+
+func (d *Database) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Close releases the underlying connection pool
+func (d *Database) Close() error {
+	return d.db.Close()
+}
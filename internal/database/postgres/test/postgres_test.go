@@ -0,0 +1,34 @@
+package postgrestests
+
+import (
+	"os"
+	"testing"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/database"
+	"github.com/FacelessWayfarer/urlshortner/internal/database/postgres"
+	"github.com/FacelessWayfarer/urlshortner/internal/database/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+// testDSN points at a disposable postgres, the tests are skipped when it is not set
+func testDSN(t *testing.T) string {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set, skipping postgres tests")
+	}
+
+	return dsn
+}
+
+func TestConformance(t *testing.T) {
+	dsn := testDSN(t)
+
+	storagetest.Run(t, func(t *testing.T) database.Storage {
+		db, err := postgres.New(dsn)
+		require.NoError(t, err)
+
+		t.Cleanup(func() { _ = db.Close() })
+
+		return db
+	})
+}
@@ -0,0 +1,2 @@
+ALTER TABLE url ADD COLUMN expires_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_expires_at ON url(expires_at);
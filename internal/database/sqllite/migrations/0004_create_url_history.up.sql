@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS url_history(
+	id INTEGER PRIMARY KEY,
+	alias TEXT NOT NULL,
+	url TEXT NOT NULL,
+	replaced_at TIMESTAMP NOT NULL);
+CREATE INDEX IF NOT EXISTS idx_url_history_alias ON url_history(alias);
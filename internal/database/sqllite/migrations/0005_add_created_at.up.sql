@@ -0,0 +1,2 @@
+-- links saved before this migration keep a NULL created_at
+ALTER TABLE url ADD COLUMN created_at TIMESTAMP;
@@ -0,0 +1,2 @@
+-- 0 redirects with the status configured for the whole server
+ALTER TABLE url ADD COLUMN redirect_code INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE url DROP COLUMN forward_path;
+ALTER TABLE url DROP COLUMN forward_query;
@@ -0,0 +1,2 @@
+-- url encoded query parameter templates, empty for links without any
+ALTER TABLE url ADD COLUMN params TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- redirects the link still serves, NULL for links without a limit
+ALTER TABLE url ADD COLUMN visits_left INTEGER;
@@ -0,0 +1,2 @@
+-- when the link starts redirecting, NULL for links active since they were saved
+ALTER TABLE url ADD COLUMN active_from TIMESTAMP;
@@ -0,0 +1,23 @@
+CREATE TABLE url_old(
+	id INTEGER PRIMARY KEY,
+	alias TEXT NOT NULL UNIQUE,
+	url TEXT NOT NULL,
+	expires_at TIMESTAMP,
+	created_at TIMESTAMP,
+	generated BOOLEAN NOT NULL DEFAULT FALSE,
+	redirect_code INTEGER NOT NULL DEFAULT 0,
+	forward_query BOOLEAN NOT NULL DEFAULT FALSE,
+	forward_path BOOLEAN NOT NULL DEFAULT FALSE,
+	params TEXT NOT NULL DEFAULT '',
+	password_hash TEXT NOT NULL DEFAULT '',
+	visits_left INTEGER,
+	active_from TIMESTAMP);
+INSERT INTO url_old(id, alias, url, expires_at, created_at, generated, redirect_code,
+	forward_query, forward_path, params, password_hash, visits_left, active_from)
+	SELECT id, alias, url, expires_at, created_at, generated, redirect_code,
+	forward_query, forward_path, params, password_hash, visits_left, active_from FROM url;
+DROP TABLE url;
+ALTER TABLE url_old RENAME TO url;
+CREATE INDEX IF NOT EXISTS idx_alias ON url(alias);
+CREATE INDEX IF NOT EXISTS idx_expires_at ON url(expires_at);
+CREATE INDEX IF NOT EXISTS idx_url ON url(url);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_alias_nocase;
+ALTER TABLE url DROP COLUMN alias_nocase;
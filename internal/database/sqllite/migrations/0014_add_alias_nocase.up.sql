@@ -0,0 +1,5 @@
+-- alias_nocase marks links saved while aliases are case insensitive, only those have to be unique ignoring case.
+-- Earlier builds created idx_alias_nocase at startup, it is replaced by the partial one
+ALTER TABLE url ADD COLUMN alias_nocase BOOLEAN NOT NULL DEFAULT FALSE;
+DROP INDEX IF EXISTS idx_alias_nocase;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_alias_nocase ON url(alias COLLATE NOCASE) WHERE alias_nocase;
@@ -2,57 +2,170 @@ package sqllite
 
 import (
 	"database/sql"
+	"embed"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/FacelessWayfarer/urlshortner/internal/database"
+	"github.com/FacelessWayfarer/urlshortner/internal/database/migrate"
+	"github.com/FacelessWayfarer/urlshortner/internal/database/sqlnull"
 	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
+var _ database.Storage = (*Database)(nil)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+var schema = migrate.MustLoad(migrations, "migrations")
+
+// aliasTables hold rows that belong to an alias and go away together with it,
+// they always store the alias exactly as the url table does
+var aliasTables = []string{"click", "url_history"}
+
+var ErrAliasCaseConflict = errors.New("aliases differ only in case")
+
 type Database struct {
 	db *sql.DB
+	// nocase makes aliases that differ only in ascii case the same alias
+	nocase bool
 }
 
+// New opens the database and applies every pending migration
 func New(dbPath string) (*Database, error) {
 	const mark = "database.sqllite.New"
 
-	db, err := sql.Open("sqlite", dbPath)
+	d, err := Open(dbPath)
 	if err != nil {
+		return nil, err
+	}
+
+	if _, err := d.Migrator().Up(); err != nil {
+		_ = d.Close()
 		return nil, fmt.Errorf("%s:%w", mark, err)
 	}
 
-	stmt, err := db.Prepare(`
-	CREATE TABLE IF NOT EXISTS url(
-		id INTEGER PRIMARY KEY,
-		alias TEXT NOT NULL UNIQUE,
-		url TEXT NOT NULL);
-	CREATE INDEX IF NOT EXISTS idx_alias ON url(alias);
-	`)
+	return d, nil
+}
+
+// Open opens the database without touching its schema
+func Open(dbPath string) (*Database, error) {
+	const mark = "database.sqllite.Open"
 
+	db, err := sql.Open("sqlite", dbPath)
 	if err != nil {
 		return nil, fmt.Errorf("%s:%w", mark, err)
 	}
 
-	_, err = stmt.Exec()
+	// sqlite allows a single writer, concurrent connections would fail with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	return &Database{db: db}, nil
+}
+
+// Migrator manages the schema of the database with the migrations embedded into the binary
+func (d *Database) Migrator() *migrate.Migrator {
+	return migrate.New(d.db, schema)
+}
+
+// CaseInsensitiveAliases makes aliases that differ only in case the same alias. Every link gets marked
+// with alias_nocase, which puts it under the unique NOCASE index of the migrations. Enabling fails with ErrAliasCaseConflict when the table already holds such aliases,
+// they are reported for the operator to resolve instead of being merged.
+// It must be called before the database is used.
+func (d *Database) CaseInsensitiveAliases(enable bool) error {
+	const mark = "database.sqllite.CaseInsensitiveAliases"
+
+	if !enable {
+		if _, err := d.db.Exec("UPDATE url SET alias_nocase = FALSE WHERE alias_nocase"); err != nil {
+			return fmt.Errorf("%s:%w", mark, err)
+		}
+		d.nocase = false
+		return nil
+	}
+
+	conflicts, err := d.AliasCaseConflicts()
+	if err != nil {
+		return fmt.Errorf("%s:%w", mark, err)
+	}
+	if len(conflicts) > 0 {
+		groups := make([]string, len(conflicts))
+		for i, group := range conflicts {
+			groups[i] = strings.Join(group, ", ")
+		}
+		return fmt.Errorf("%s: %w: %s", mark, ErrAliasCaseConflict, strings.Join(groups, "; "))
+	}
+
+	if _, err := d.db.Exec("UPDATE url SET alias_nocase = TRUE WHERE NOT alias_nocase"); err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%s: %w", mark, ErrAliasCaseConflict)
+		}
+		return fmt.Errorf("%s:%w", mark, err)
+	}
+	d.nocase = true
+
+	return nil
+}
+
+// AliasCaseConflicts lists groups of saved aliases that differ only in case
+func (d *Database) AliasCaseConflicts() ([][]string, error) {
+	const mark = "database.sqllite.AliasCaseConflicts"
+
+	// lower and NOCASE both fold ascii letters only
+	rows, err := d.db.Query(`SELECT lower(alias), alias FROM url WHERE lower(alias) IN (
+		SELECT lower(alias) FROM url GROUP BY lower(alias) HAVING COUNT(*) > 1)
+		ORDER BY 1, 2`)
 	if err != nil {
 		return nil, fmt.Errorf("%s:%w", mark, err)
 	}
+	defer rows.Close()
 
-	return &Database{db: db}, nil
+	var (
+		conflicts [][]string
+		last      string
+	)
+	for rows.Next() {
+		var folded, alias string
+		if err := rows.Scan(&folded, &alias); err != nil {
+			return nil, fmt.Errorf("%s:%w", mark, err)
+		}
+		if len(conflicts) == 0 || folded != last {
+			conflicts = append(conflicts, nil)
+			last = folded
+		}
+		conflicts[len(conflicts)-1] = append(conflicts[len(conflicts)-1], alias)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return conflicts, nil
+}
+
+// aliasIs compares the alias column with a placeholder under the configured case policy
+func (d *Database) aliasIs() string {
+	if d.nocase {
+		// every link is marked then, the mark lets sqlite use the partial index
+		return "alias_nocase AND alias = ? COLLATE NOCASE"
+	}
+	return "alias = ?"
 }
 
-func (d *Database) SaveURL(longURL, alias string) (int64, error) {
+func (d *Database) SaveURL(link database.Link) (int64, error) {
 	const mark = "database.sqllite.SaveURL"
 
-	stmt, err := d.db.Prepare("INSERT INTO url(url,alias) VALUES(?,?)")
+	stmt, err := d.db.Prepare("INSERT INTO url(alias_nocase, " + linkFields + ") VALUES(?, " + linkPlaceholders + ")")
 	if err != nil {
 		return 0, fmt.Errorf("%s:%w", mark, err)
 	}
 
-	rst, err := stmt.Exec(longURL, alias)
+	link.CreatedAt = time.Now().UTC()
+
+	rst, err := stmt.Exec(append([]any{d.nocase}, linkArgs(link)...)...)
 	if err != nil {
-		sqliteErr := err.(*sqlite.Error)
-		if sqliteErr.Code() == 2067 {
+		if isUniqueViolation(err) {
 			return 0, fmt.Errorf("%s: %w", mark, database.ErrURLAlreadyExists)
 		}
 		return 0, fmt.Errorf("%s:%w", mark, err)
@@ -66,36 +179,530 @@ func (d *Database) SaveURL(longURL, alias string) (int64, error) {
 
 }
 
-func (d *Database) GetURL(alias string) (url string, err error) {
+func (d *Database) SaveGeneratedURL(link database.Link, newAlias database.AliasFunc) (database.Link, error) {
+	const mark = "database.sqllite.SaveGeneratedURL"
+
+	link.CreatedAt = time.Now().UTC()
+
+	err := d.inTx(func(tx *sql.Tx) error {
+		var err error
+		link, err = insertGenerated(tx, link, newAlias, d.nocase)
+		return err
+	})
+	if err != nil {
+		return database.Link{}, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return link, nil
+}
+
+func (d *Database) FindOrSaveGeneratedURL(link database.Link, newAlias database.AliasFunc) (database.Link, bool, error) {
+	const mark = "database.sqllite.FindOrSaveGeneratedURL"
+
+	link.CreatedAt = time.Now().UTC()
+
+	var found bool
+
+	err := d.inTx(func(tx *sql.Tx) error {
+		if link.ExpiresAt == nil && link.ActiveFrom == nil && link.VisitsLeft == nil {
+			existing, err := scanLink(tx.QueryRow("SELECT "+linkColumns+` FROM url
+				WHERE url = ? AND generated AND expires_at IS NULL AND active_from IS NULL AND visits_left IS NULL
+					AND redirect_code = ? AND forward_query = ? AND forward_path = ? AND params = ? AND password_hash = ?
+				ORDER BY id LIMIT 1`, link.URL, link.RedirectCode, link.ForwardQuery, link.ForwardPath,
+				sqlnull.FromParams(link.Params), link.PasswordHash))
+			if err == nil {
+				link, found = existing, true
+				return nil
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+		}
+
+		var err error
+		link, err = insertGenerated(tx, link, newAlias, d.nocase)
+		return err
+	})
+	if err != nil {
+		return database.Link{}, false, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return link, found, nil
+}
+
+func (d *Database) SaveURLs(links []database.Link, newAlias database.AliasFunc) ([]database.SaveResult, error) {
+	const mark = "database.sqllite.SaveURLs"
+
+	results := make([]database.SaveResult, len(links))
+
+	err := d.inTx(func(tx *sql.Tx) error {
+		// no conflict target, so the NOCASE index counts too
+		stmt, err := tx.Prepare("INSERT INTO url(id, alias_nocase, " + linkFields + ") VALUES(?, ?, " + linkPlaceholders + `)
+			ON CONFLICT DO NOTHING`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		now := time.Now().UTC()
+		for i, link := range links {
+			link.CreatedAt = now
+
+			if link.Alias == "" && newAlias != nil {
+				saved, err := insertGenerated(tx, link, newAlias, d.nocase)
+				if errors.Is(err, database.ErrAliasExhausted) {
+					results[i].Err = fmt.Errorf("%s: %w", mark, err)
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				results[i].ID, results[i].Alias = saved.ID, saved.Alias
+				continue
+			}
+			results[i].Alias = link.Alias
+
+			id, err := nextID(tx)
+			if err != nil {
+				return err
+			}
+
+			rst, err := stmt.Exec(append([]any{id, d.nocase}, linkArgs(link)...)...)
+			if err != nil {
+				return err
+			}
+
+			n, err := rst.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				results[i].Err = fmt.Errorf("%s: %w", mark, database.ErrURLAlreadyExists)
+				continue
+			}
+
+			results[i].ID = id
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return results, nil
+}
+
+// insertGenerated inserts link under the first free alias newAlias makes,
+// the unique constraints on alias are the only collision check. nocase marks the link for the NOCASE index
+func insertGenerated(tx *sql.Tx, link database.Link, newAlias database.AliasFunc, nocase bool) (database.Link, error) {
+	base, err := nextID(tx)
+	if err != nil {
+		return database.Link{}, err
+	}
+
+	for attempt := 0; attempt < database.AliasAttempts; attempt++ {
+		// the id moves on with every attempt so id based aliases change too
+		id := base + int64(attempt)
+
+		link.Alias, err = newAlias(id, attempt)
+		if errors.Is(err, database.ErrAliasRejected) {
+			continue
+		}
+		if err != nil {
+			return database.Link{}, err
+		}
+
+		rst, err := tx.Exec("INSERT INTO url(id, generated, alias_nocase, "+linkFields+") VALUES(?, TRUE, ?, "+linkPlaceholders+`)
+			ON CONFLICT DO NOTHING`, append([]any{id, nocase}, linkArgs(link)...)...)
+		if err != nil {
+			return database.Link{}, err
+		}
+
+		n, err := rst.RowsAffected()
+		if err != nil {
+			return database.Link{}, err
+		}
+		if n == 1 {
+			link.ID, link.Generated = id, true
+			return link, nil
+		}
+	}
+
+	return database.Link{}, database.ErrAliasExhausted
+}
+
+// nextID is the id the next url inserted within tx gets, ids of deleted urls are never reused.
+// sqlite serializes writers so nobody takes it before tx commits
+func nextID(tx *sql.Tx) (int64, error) {
+	var id int64
+	// sqlite_sequence holds the largest id the url table ever had, it has no row before the first insert
+	err := tx.QueryRow("SELECT COALESCE((SELECT seq FROM sqlite_sequence WHERE name = 'url'), 0) + 1").Scan(&id)
+	return id, err
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+func (d *Database) GetURL(alias string) (database.Link, error) {
 	const mark = "database.sqllite.GetURL"
 
-	stmt, err := d.db.Prepare("SELECT url FROM url WHERE alias = ?")
+	stmt, err := d.db.Prepare("SELECT " + linkColumns + " FROM url WHERE " + d.aliasIs())
 	if err != nil {
-		return "", fmt.Errorf("%s:%w", mark, err)
+		return database.Link{}, fmt.Errorf("%s:%w", mark, err)
 	}
 
-	err = stmt.QueryRow(alias).Scan(&url)
+	link, err := scanLink(stmt.QueryRow(alias))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return "", database.ErrURLNotFound
+			return database.Link{}, database.ErrURLNotFound
 		}
-		return "", fmt.Errorf("%s:%w", mark, err)
+		return database.Link{}, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return link, nil
+}
+
+// UseVisit decrements the counter in one statement, concurrent visits can not drive it below zero
+func (d *Database) UseVisit(alias string) error {
+	const mark = "database.sqllite.UseVisit"
+
+	res, err := d.db.Exec("UPDATE url SET visits_left = visits_left - 1 WHERE "+d.aliasIs()+" AND visits_left > 0", alias)
+	if err != nil {
+		return fmt.Errorf("%s:%w", mark, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s:%w", mark, err)
+	}
+	if n == 0 {
+		return database.ErrNoVisitsLeft
 	}
 
-	return url, nil
+	return nil
+}
+
+func (d *Database) ListURLs(filter database.ListFilter) ([]database.Link, error) {
+	const mark = "database.sqllite.ListURLs"
+
+	var (
+		where []string
+		args  []any
+	)
+
+	if filter.AliasPrefix != "" {
+		if d.nocase {
+			where = append(where, "substr(alias, 1, length(?)) = ? COLLATE NOCASE")
+		} else {
+			where = append(where, "substr(alias, 1, length(?)) = ?")
+		}
+		args = append(args, filter.AliasPrefix, filter.AliasPrefix)
+	}
+	if filter.URLContains != "" {
+		where = append(where, "instr(url, ?) > 0")
+		args = append(args, filter.URLContains)
+	}
+
+	order := "ASC"
+	if filter.Desc {
+		order = "DESC"
+	}
+	if filter.Cursor != 0 {
+		if filter.Desc {
+			where = append(where, "id < ?")
+		} else {
+			where = append(where, "id > ?")
+		}
+		args = append(args, filter.Cursor)
+	}
+
+	query := "SELECT " + linkColumns + " FROM url"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id " + order + " LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+	defer rows.Close()
+
+	var links []database.Link
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%w", mark, err)
+		}
+		links = append(links, link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return links, nil
 }
 
 func (d *Database) DeleteURL(alias string) error {
 	const mark = "database.sqllite.DeleteURL"
 
-	stmt, err := d.db.Prepare("DELETE FROM url WHERE alias = ?")
+	err := d.inTx(func(tx *sql.Tx) error {
+		alias, err := d.storedAlias(tx, alias)
+		if err != nil {
+			return err
+		}
+
+		for _, table := range aliasTables {
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE alias = ?", alias); err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec("DELETE FROM url WHERE alias = ?", alias)
+		return err
+	})
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.ErrURLNotFound
+		}
 		return fmt.Errorf("%s:%w", mark, err)
 	}
+	return nil
+}
+
+func (d *Database) DeleteExpired(now time.Time) (int64, error) {
+	const mark = "database.sqllite.DeleteExpired"
+
+	var n int64
+
+	err := d.inTx(func(tx *sql.Tx) error {
+		for _, table := range aliasTables {
+			_, err := tx.Exec("DELETE FROM "+table+` WHERE alias IN (
+				SELECT alias FROM url WHERE expires_at IS NOT NULL AND expires_at <= ?)`, now.UTC())
+			if err != nil {
+				return err
+			}
+		}
+
+		rst, err := tx.Exec("DELETE FROM url WHERE expires_at IS NOT NULL AND expires_at <= ?", now.UTC())
+		if err != nil {
+			return err
+		}
+
+		n, err = rst.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return n, nil
+}
+
+func (d *Database) UpdateURL(alias, url string) (string, error) {
+	const mark = "database.sqllite.UpdateURL"
+
+	var previous string
+
+	err := d.inTx(func(tx *sql.Tx) error {
+		err := tx.QueryRow("SELECT alias, url FROM url WHERE "+d.aliasIs(), alias).Scan(&alias, &previous)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("INSERT INTO url_history(alias, url, replaced_at) VALUES(?,?,?)",
+			alias, previous, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE url SET url = ? WHERE alias = ?", url, alias)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", database.ErrURLNotFound
+		}
+		return "", fmt.Errorf("%s:%w", mark, err)
+	}
 
-	_, err = stmt.Exec(alias)
+	return previous, nil
+}
+
+func (d *Database) GetHistory(alias string) ([]database.HistoryEntry, error) {
+	const mark = "database.sqllite.GetHistory"
+
+	alias, err := d.storedAlias(d.db, alias)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, database.ErrURLNotFound
+		}
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	rows, err := d.db.Query("SELECT url, replaced_at FROM url_history WHERE alias = ? ORDER BY id DESC", alias)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+	defer rows.Close()
+
+	var history []database.HistoryEntry
+	for rows.Next() {
+		var entry database.HistoryEntry
+		if err := rows.Scan(&entry.URL, &entry.ReplacedAt); err != nil {
+			return nil, fmt.Errorf("%s:%w", mark, err)
+		}
+		entry.ReplacedAt = entry.ReplacedAt.UTC()
+		history = append(history, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return history, nil
+}
+
+func (d *Database) SaveClicks(clicks []database.Click) error {
+	const mark = "database.sqllite.SaveClicks"
+
+	err := d.inTx(func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(`INSERT INTO click(alias, clicked_at, referrer, user_agent, request_id)
+			VALUES(?,?,?,?,?)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, c := range clicks {
+			if _, err := stmt.Exec(c.Alias, c.ClickedAt.Unix(), c.Referrer, c.UserAgent, c.RequestID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return fmt.Errorf("%s:%w", mark, err)
 	}
+
 	return nil
 }
+
+func (d *Database) GetStats(alias string, since time.Time, bucket time.Duration) (database.Stats, error) {
+	const mark = "database.sqllite.GetStats"
+
+	alias, err := d.storedAlias(d.db, alias)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.Stats{}, database.ErrURLNotFound
+		}
+		return database.Stats{}, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	var stats database.Stats
+
+	err = d.db.QueryRow("SELECT COUNT(*) FROM click WHERE alias = ?", alias).Scan(&stats.Total)
+	if err != nil {
+		return database.Stats{}, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	size := int64(bucket / time.Second)
+
+	rows, err := d.db.Query(`SELECT clicked_at - clicked_at % ? AS bucket, COUNT(*) FROM click
+		WHERE alias = ? AND clicked_at >= ?
+		GROUP BY bucket ORDER BY bucket`, size, alias, database.BucketStart(since, bucket).Unix())
+	if err != nil {
+		return database.Stats{}, fmt.Errorf("%s:%w", mark, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			start int64
+			b     database.Bucket
+		)
+		if err := rows.Scan(&start, &b.Count); err != nil {
+			return database.Stats{}, fmt.Errorf("%s:%w", mark, err)
+		}
+		b.Start = time.Unix(start, 0).UTC()
+		stats.Buckets = append(stats.Buckets, b)
+	}
+	if err := rows.Err(); err != nil {
+		return database.Stats{}, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	return stats, nil
+}
+
+// storedAlias is the alias as saved in the url table, the one rows of aliasTables use
+func (d *Database) storedAlias(q interface {
+	QueryRow(query string, args ...any) *sql.Row
+}, alias string) (string, error) {
+	var stored string
+	err := q.QueryRow("SELECT alias FROM url WHERE "+d.aliasIs(), alias).Scan(&stored)
+	return stored, err
+}
+
+// linkFields are the columns a new link is inserted with, linkArgs returns their values in this order
+const linkFields = "url, alias, created_at, expires_at, redirect_code, forward_query, forward_path, params, password_hash, visits_left, active_from"
+
+var linkPlaceholders = strings.TrimSuffix(strings.Repeat("?, ", strings.Count(linkFields, ",")+1), ", ")
+
+func linkArgs(link database.Link) []any {
+	return []any{
+		link.URL, link.Alias, link.CreatedAt, sqlnull.FromTime(link.ExpiresAt),
+		link.RedirectCode, link.ForwardQuery, link.ForwardPath, sqlnull.FromParams(link.Params),
+		link.PasswordHash, sqlnull.FromInt(link.VisitsLeft), sqlnull.FromTime(link.ActiveFrom),
+	}
+}
+
+// linkColumns are read by scanLink in this order
+const linkColumns = "id, alias, url, created_at, expires_at, generated, redirect_code, forward_query, forward_path, params, password_hash, visits_left, active_from"
+
+func scanLink(row interface{ Scan(dest ...any) error }) (database.Link, error) {
+	var (
+		link       database.Link
+		createdAt  sql.NullTime
+		expiresAt  sql.NullTime
+		params     string
+		visits     sql.NullInt64
+		activeFrom sql.NullTime
+	)
+
+	if err := row.Scan(&link.ID, &link.Alias, &link.URL, &createdAt, &expiresAt, &link.Generated,
+		&link.RedirectCode, &link.ForwardQuery, &link.ForwardPath, &params, &link.PasswordHash, &visits, &activeFrom); err != nil {
+		return database.Link{}, err
+	}
+
+	var err error
+	if link.Params, err = sqlnull.ToParams(params); err != nil {
+		return database.Link{}, err
+	}
+
+	link.CreatedAt = createdAt.Time.UTC()
+	link.ExpiresAt = sqlnull.ToTime(expiresAt)
+	link.VisitsLeft = sqlnull.ToInt(visits)
+	link.ActiveFrom = sqlnull.ToTime(activeFrom)
+
+	return link, nil
+}
+
+func (d *Database) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Close releases the database file
+func (d *Database) Close() error {
+	return d.db.Close()
+}
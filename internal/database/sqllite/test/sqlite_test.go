@@ -0,0 +1,177 @@
+package sqlitetests
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/database"
+	"github.com/FacelessWayfarer/urlshortner/internal/database/sqllite"
+	"github.com/FacelessWayfarer/urlshortner/internal/database/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDatabase(t *testing.T) database.Storage {
+	db, err := sqllite.New(filepath.Join(t.TempDir(), "database.db"))
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, newTestDatabase)
+}
+
+// TestUnversionedDatabase opens a database created before migrations existed
+func TestUnversionedDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.db")
+
+	raw, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	_, err = raw.Exec(`
+	CREATE TABLE IF NOT EXISTS url(
+		id INTEGER PRIMARY KEY,
+		alias TEXT NOT NULL UNIQUE,
+		url TEXT NOT NULL);
+	INSERT INTO url(url, alias) VALUES('https://google.com', 'google');
+	`)
+	require.NoError(t, err)
+	require.NoError(t, raw.Close())
+
+	db, err := sqllite.New(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	got, err := db.GetURL("google")
+	require.NoError(t, err)
+	require.Equal(t, "https://google.com", got.URL)
+
+	statuses, err := db.Migrator().Status()
+	require.NoError(t, err)
+	for _, s := range statuses {
+		require.True(t, s.Applied, "migration %d_%s must be applied", s.Version, s.Name)
+	}
+}
+
+func TestCaseInsensitiveAliases(t *testing.T) {
+	db, err := sqllite.New(filepath.Join(t.TempDir(), "database.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, err = db.SaveURL(database.Link{Alias: "Google", URL: "https://google.com/"})
+	require.NoError(t, err)
+
+	require.NoError(t, db.CaseInsensitiveAliases(true))
+
+	got, err := db.GetURL("gOOGLE")
+	require.NoError(t, err)
+	require.Equal(t, "Google", got.Alias)
+
+	_, err = db.SaveURL(database.Link{Alias: "GOOGLE", URL: "https://google.com/"})
+	require.ErrorIs(t, err, database.ErrURLAlreadyExists)
+
+	results, err := db.SaveURLs([]database.Link{{Alias: "google", URL: "https://google.com/"}}, nil)
+	require.NoError(t, err)
+	require.ErrorIs(t, results[0].Err, database.ErrURLAlreadyExists)
+
+	// the first generated alias clashes in case only, the next attempt is free
+	generated, err := db.SaveGeneratedURL(database.Link{URL: "https://google.com/"}, func(_ int64, attempt int) (string, error) {
+		if attempt == 0 {
+			return "GOOGLE", nil
+		}
+		return "bing", nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "bing", generated.Alias)
+
+	require.NoError(t, db.SaveClicks([]database.Click{{Alias: "Google", ClickedAt: time.Now()}}))
+
+	stats, err := db.GetStats("google", time.Now().Add(-time.Hour), time.Hour)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, stats.Total)
+
+	previous, err := db.UpdateURL("GOOGLE", "https://yandex.ru/")
+	require.NoError(t, err)
+	require.Equal(t, "https://google.com/", previous)
+
+	history, err := db.GetHistory("google")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+
+	links, err := db.ListURLs(database.ListFilter{AliasPrefix: "goo", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+
+	require.NoError(t, db.DeleteURL("gOoGlE"))
+	require.ErrorIs(t, db.DeleteURL("google"), database.ErrURLNotFound)
+
+	// switching back makes the case matter again
+	require.NoError(t, db.CaseInsensitiveAliases(false))
+
+	_, err = db.SaveURL(database.Link{Alias: "Bing", URL: "https://bing.com/"})
+	require.NoError(t, err)
+	_, err = db.GetURL("BING")
+	require.ErrorIs(t, err, database.ErrURLNotFound)
+}
+
+func TestCaseInsensitiveAliases_Conflicts(t *testing.T) {
+	db, err := sqllite.New(filepath.Join(t.TempDir(), "database.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	for _, alias := range []string{"abc", "ABC", "Abc", "xyz", "Google", "google"} {
+		_, err := db.SaveURL(database.Link{Alias: alias, URL: "https://example.com/"})
+		require.NoError(t, err)
+	}
+
+	conflicts, err := db.AliasCaseConflicts()
+	require.NoError(t, err)
+	require.Equal(t, [][]string{{"ABC", "Abc", "abc"}, {"Google", "google"}}, conflicts)
+
+	err = db.CaseInsensitiveAliases(true)
+	require.ErrorIs(t, err, sqllite.ErrAliasCaseConflict)
+	require.ErrorContains(t, err, "ABC, Abc, abc; Google, google")
+
+	// nothing got merged
+	got, err := db.GetURL("Abc")
+	require.NoError(t, err)
+	require.Equal(t, "Abc", got.Alias)
+}
+
+// TestCaseInsensitiveAliases_Versioned checks the NOCASE index is part of the schema,
+// switching the mode only marks the links
+func TestCaseInsensitiveAliases_Versioned(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.db")
+
+	db, err := sqllite.New(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	raw, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = raw.Close() })
+
+	schema := func() string {
+		var ddl string
+		require.NoError(t, raw.QueryRow("SELECT group_concat(sql, ';') FROM sqlite_master ORDER BY name").Scan(&ddl))
+		return ddl
+	}
+
+	before := schema()
+	require.Contains(t, before, "idx_alias_nocase")
+
+	require.NoError(t, db.CaseInsensitiveAliases(true))
+	require.Equal(t, before, schema())
+
+	_, err = db.SaveURL(database.Link{Alias: "Google", URL: "https://google.com/"})
+	require.NoError(t, err)
+
+	require.NoError(t, db.CaseInsensitiveAliases(false))
+	require.Equal(t, before, schema())
+
+	_, err = db.SaveURL(database.Link{Alias: "google", URL: "https://google.com/"})
+	require.NoError(t, err, "case sensitive aliases may differ in case only")
+}
@@ -0,0 +1,74 @@
+// Package sqlnull converts optional Link fields to and from the column types
+// shared by the sql backends.
+package sqlnull
+
+import (
+	"database/sql"
+	"net/url"
+	"time"
+)
+
+// FromTime stores times in UTC so they compare correctly as text in sqlite
+func FromTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+func ToTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+
+	v := t.Time.UTC()
+
+	return &v
+}
+
+// FromParams stores params url encoded, no params are an empty string
+func FromParams(params map[string]string) string {
+	values := make(url.Values, len(params))
+	for key, value := range params {
+		values.Set(key, value)
+	}
+
+	return values.Encode()
+}
+
+func ToParams(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	values, err := url.ParseQuery(s)
+	if err != nil {
+		return nil, err
+	}
+
+	params := make(map[string]string, len(values))
+	for key := range values {
+		params[key] = values.Get(key)
+	}
+
+	return params, nil
+}
+
+func FromInt(n *int) sql.NullInt64 {
+	if n == nil {
+		return sql.NullInt64{}
+	}
+
+	return sql.NullInt64{Int64: int64(*n), Valid: true}
+}
+
+func ToInt(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+
+	v := int(n.Int64)
+
+	return &v
+}
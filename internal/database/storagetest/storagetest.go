@@ -0,0 +1,978 @@
+// Package storagetest is a conformance suite every database.Storage backend runs
+// to prove it behaves the same way as the others.
+package storagetest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/database"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/random"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns a ready to use storage, cleanup should be registered on t
+type Factory func(t *testing.T) database.Storage
+
+func Run(t *testing.T, newStorage Factory) {
+	t.Run("SaveGet", func(t *testing.T) { testSaveGet(t, newStorage(t)) })
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, newStorage(t)) })
+	t.Run("AlreadyExists", func(t *testing.T) { testAlreadyExists(t, newStorage(t)) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, newStorage(t)) })
+	t.Run("IDsNotReused", func(t *testing.T) { testIDsNotReused(t, newStorage(t)) })
+	t.Run("DeleteMissing", func(t *testing.T) { testDeleteMissing(t, newStorage(t)) })
+	t.Run("ConcurrentSaves", func(t *testing.T) { testConcurrentSaves(t, newStorage(t)) })
+	t.Run("ConcurrentSameAlias", func(t *testing.T) { testConcurrentSameAlias(t, newStorage(t)) })
+	t.Run("ExpiresAt", func(t *testing.T) { testExpiresAt(t, newStorage(t)) })
+	t.Run("DeleteExpired", func(t *testing.T) { testDeleteExpired(t, newStorage(t)) })
+	t.Run("Stats", func(t *testing.T) { testStats(t, newStorage(t)) })
+	t.Run("StatsNotFound", func(t *testing.T) { testStatsNotFound(t, newStorage(t)) })
+	t.Run("DeleteRemovesClicks", func(t *testing.T) { testDeleteRemovesClicks(t, newStorage(t)) })
+	t.Run("UpdateURL", func(t *testing.T) { testUpdateURL(t, newStorage(t)) })
+	t.Run("UpdateNotFound", func(t *testing.T) { testUpdateNotFound(t, newStorage(t)) })
+	t.Run("ConcurrentUpdates", func(t *testing.T) { testConcurrentUpdates(t, newStorage(t)) })
+	t.Run("DeleteRemovesHistory", func(t *testing.T) { testDeleteRemovesHistory(t, newStorage(t)) })
+	t.Run("CreatedAt", func(t *testing.T) { testCreatedAt(t, newStorage(t)) })
+	t.Run("ListPages", func(t *testing.T) { testListPages(t, newStorage(t)) })
+	t.Run("ListFilters", func(t *testing.T) { testListFilters(t, newStorage(t)) })
+	t.Run("SaveURLs", func(t *testing.T) { testSaveURLs(t, newStorage(t)) })
+	t.Run("SaveGeneratedURL", func(t *testing.T) { testSaveGeneratedURL(t, newStorage(t)) })
+	t.Run("GeneratedSkipsTakenID", func(t *testing.T) { testGeneratedSkipsTakenID(t, newStorage(t)) })
+	t.Run("GeneratedSkipsRejected", func(t *testing.T) { testGeneratedSkipsRejected(t, newStorage(t)) })
+	t.Run("FindOrSaveGeneratedURL", func(t *testing.T) { testFindOrSaveGeneratedURL(t, newStorage(t)) })
+	t.Run("ConcurrentFindOrSave", func(t *testing.T) { testConcurrentFindOrSave(t, newStorage(t)) })
+	t.Run("ConcurrentGeneratedSaves", func(t *testing.T) { testConcurrentGeneratedSaves(t, newStorage(t)) })
+	t.Run("RedirectCode", func(t *testing.T) { testRedirectCode(t, newStorage(t)) })
+	t.Run("Forwarding", func(t *testing.T) { testForwarding(t, newStorage(t)) })
+	t.Run("Params", func(t *testing.T) { testParams(t, newStorage(t)) })
+	t.Run("PasswordHash", func(t *testing.T) { testPasswordHash(t, newStorage(t)) })
+	t.Run("Visits", func(t *testing.T) { testVisits(t, newStorage(t)) })
+	t.Run("ActiveFrom", func(t *testing.T) { testActiveFrom(t, newStorage(t)) })
+}
+
+// newAlias is random so suites can run against a shared database
+func newAlias() string {
+	return random.NewRandomString(12)
+}
+
+func testSaveGet(t *testing.T, s database.Storage) {
+	alias := newAlias()
+	url := "https://google.com"
+
+	id, err := s.SaveURL(database.Link{URL: url, Alias: alias})
+	require.NoError(t, err)
+	require.NotZero(t, id)
+
+	got, err := s.GetURL(alias)
+	require.NoError(t, err)
+	require.Equal(t, id, got.ID)
+	require.Equal(t, alias, got.Alias)
+	require.Equal(t, url, got.URL)
+	require.Nil(t, got.ExpiresAt)
+}
+
+func testNotFound(t *testing.T, s database.Storage) {
+	_, err := s.GetURL(newAlias())
+	require.ErrorIs(t, err, database.ErrURLNotFound)
+}
+
+func testAlreadyExists(t *testing.T, s database.Storage) {
+	alias := newAlias()
+
+	_, err := s.SaveURL(database.Link{URL: "https://google.com", Alias: alias})
+	require.NoError(t, err)
+
+	_, err = s.SaveURL(database.Link{URL: "https://yandex.ru", Alias: alias})
+	require.ErrorIs(t, err, database.ErrURLAlreadyExists)
+
+	got, err := s.GetURL(alias)
+	require.NoError(t, err)
+	require.Equal(t, "https://google.com", got.URL, "the first url must be kept")
+}
+
+func testDelete(t *testing.T, s database.Storage) {
+	alias := newAlias()
+
+	_, err := s.SaveURL(database.Link{URL: "https://google.com", Alias: alias})
+	require.NoError(t, err)
+
+	require.NoError(t, s.DeleteURL(alias))
+
+	_, err = s.GetURL(alias)
+	require.ErrorIs(t, err, database.ErrURLNotFound)
+
+	_, err = s.SaveURL(database.Link{URL: "https://yandex.ru", Alias: alias})
+	require.NoError(t, err, "a deleted alias must be free again")
+}
+
+// testIDsNotReused covers deleting the newest link, its id based alias must not be generated again
+func testIDsNotReused(t *testing.T, s database.Storage) {
+	prefix := newAlias()
+
+	newest, err := s.SaveGeneratedURL(database.Link{URL: "https://google.com"}, idAlias(prefix))
+	require.NoError(t, err)
+
+	require.NoError(t, s.DeleteURL(newest.Alias))
+
+	link, err := s.SaveGeneratedURL(database.Link{URL: "https://yandex.ru"}, idAlias(prefix))
+	require.NoError(t, err)
+	require.Greater(t, link.ID, newest.ID)
+	require.NotEqual(t, newest.Alias, link.Alias)
+
+	id, err := s.SaveURL(database.Link{URL: "https://yandex.ru", Alias: newAlias()})
+	require.NoError(t, err)
+	require.Greater(t, id, link.ID)
+}
+
+func testDeleteMissing(t *testing.T, s database.Storage) {
+	require.ErrorIs(t, s.DeleteURL(newAlias()), database.ErrURLNotFound)
+}
+
+func testConcurrentSaves(t *testing.T, s database.Storage) {
+	const workers = 20
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		ids  = make(map[int64]struct{}, workers)
+		errs []error
+	)
+
+	aliases := make([]string, workers)
+	for i := range aliases {
+		aliases[i] = newAlias()
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			id, err := s.SaveURL(database.Link{URL: fmt.Sprintf("https://google.com/%d", i), Alias: aliases[i]})
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			ids[id] = struct{}{}
+		}(i)
+	}
+	wg.Wait()
+
+	require.Empty(t, errs)
+	require.Len(t, ids, workers, "every save must get its own id")
+
+	for i, alias := range aliases {
+		got, err := s.GetURL(alias)
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("https://google.com/%d", i), got.URL)
+	}
+}
+
+func testConcurrentSameAlias(t *testing.T, s database.Storage) {
+	const workers = 20
+
+	alias := newAlias()
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		saved  int
+		exists int
+		errs   []error
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := s.SaveURL(database.Link{URL: "https://google.com", Alias: alias})
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				saved++
+			case errors.Is(err, database.ErrURLAlreadyExists):
+				exists++
+			default:
+				errs = append(errs, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Empty(t, errs)
+	require.Equal(t, 1, saved)
+	require.Equal(t, workers-1, exists)
+}
+
+func testExpiresAt(t *testing.T, s database.Storage) {
+	alias := newAlias()
+	expiresAt := time.Now().Add(time.Hour)
+
+	_, err := s.SaveURL(database.Link{URL: "https://google.com", Alias: alias, ExpiresAt: &expiresAt})
+	require.NoError(t, err)
+
+	got, err := s.GetURL(alias)
+	require.NoError(t, err)
+	require.NotNil(t, got.ExpiresAt)
+	require.WithinDuration(t, expiresAt, *got.ExpiresAt, time.Millisecond)
+	require.False(t, got.Expired(time.Now()))
+	require.True(t, got.Expired(expiresAt))
+}
+
+func testDeleteExpired(t *testing.T, s database.Storage) {
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Hour)
+
+	expired, live, permanent := newAlias(), newAlias(), newAlias()
+
+	_, err := s.SaveURL(database.Link{URL: "https://google.com", Alias: expired, ExpiresAt: &past})
+	require.NoError(t, err)
+	_, err = s.SaveURL(database.Link{URL: "https://google.com", Alias: live, ExpiresAt: &future})
+	require.NoError(t, err)
+	_, err = s.SaveURL(database.Link{URL: "https://google.com", Alias: permanent})
+	require.NoError(t, err)
+
+	n, err := s.DeleteExpired(now)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, n, int64(1))
+
+	_, err = s.GetURL(expired)
+	require.ErrorIs(t, err, database.ErrURLNotFound)
+
+	_, err = s.GetURL(live)
+	require.NoError(t, err)
+
+	_, err = s.GetURL(permanent)
+	require.NoError(t, err)
+}
+
+func testStats(t *testing.T, s database.Storage) {
+	alias := newAlias()
+
+	_, err := s.SaveURL(database.Link{URL: "https://google.com", Alias: alias})
+	require.NoError(t, err)
+
+	hour := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	err = s.SaveClicks([]database.Click{
+		{Alias: alias, ClickedAt: hour.Add(-2 * time.Hour), Referrer: "https://t.me", UserAgent: "curl", RequestID: "1"},
+		{Alias: alias, ClickedAt: hour.Add(5 * time.Minute)},
+		{Alias: alias, ClickedAt: hour.Add(59 * time.Minute)},
+		{Alias: alias, ClickedAt: hour.Add(2*time.Hour + time.Second)},
+		{Alias: newAlias(), ClickedAt: hour},
+	})
+	require.NoError(t, err)
+
+	stats, err := s.GetStats(alias, hour.Add(30*time.Minute), time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, int64(4), stats.Total)
+	require.Equal(t, []database.Bucket{
+		{Start: hour, Count: 2},
+		{Start: hour.Add(2 * time.Hour), Count: 1},
+	}, stats.Buckets)
+
+	stats, err = s.GetStats(alias, hour.Add(-24*time.Hour), 24*time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, []database.Bucket{
+		{Start: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), Count: 4},
+	}, stats.Buckets)
+}
+
+func testStatsNotFound(t *testing.T, s database.Storage) {
+	_, err := s.GetStats(newAlias(), time.Now(), time.Hour)
+	require.ErrorIs(t, err, database.ErrURLNotFound)
+}
+
+func testDeleteRemovesClicks(t *testing.T, s database.Storage) {
+	alias := newAlias()
+
+	_, err := s.SaveURL(database.Link{URL: "https://google.com", Alias: alias})
+	require.NoError(t, err)
+
+	require.NoError(t, s.SaveClicks([]database.Click{{Alias: alias, ClickedAt: time.Now()}}))
+	require.NoError(t, s.DeleteURL(alias))
+
+	_, err = s.SaveURL(database.Link{URL: "https://yandex.ru", Alias: alias})
+	require.NoError(t, err)
+
+	stats, err := s.GetStats(alias, time.Now().Add(-time.Hour), time.Hour)
+	require.NoError(t, err)
+	require.Zero(t, stats.Total, "a reused alias must not inherit clicks")
+	require.Empty(t, stats.Buckets)
+}
+
+func testUpdateURL(t *testing.T, s database.Storage) {
+	alias := newAlias()
+	expiresAt := time.Now().Add(time.Hour)
+
+	id, err := s.SaveURL(database.Link{URL: "https://google.com", Alias: alias, ExpiresAt: &expiresAt})
+	require.NoError(t, err)
+
+	previous, err := s.UpdateURL(alias, "https://yandex.ru")
+	require.NoError(t, err)
+	require.Equal(t, "https://google.com", previous)
+
+	previous, err = s.UpdateURL(alias, "https://bing.com")
+	require.NoError(t, err)
+	require.Equal(t, "https://yandex.ru", previous)
+
+	got, err := s.GetURL(alias)
+	require.NoError(t, err)
+	require.Equal(t, "https://bing.com", got.URL)
+	require.Equal(t, id, got.ID, "update must keep the row")
+	require.NotNil(t, got.ExpiresAt, "update must keep the other fields")
+
+	history, err := s.GetHistory(alias)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.Equal(t, "https://yandex.ru", history[0].URL)
+	require.Equal(t, "https://google.com", history[1].URL)
+	require.False(t, history[0].ReplacedAt.Before(history[1].ReplacedAt))
+}
+
+func testUpdateNotFound(t *testing.T, s database.Storage) {
+	_, err := s.UpdateURL(newAlias(), "https://google.com")
+	require.ErrorIs(t, err, database.ErrURLNotFound)
+
+	_, err = s.GetHistory(newAlias())
+	require.ErrorIs(t, err, database.ErrURLNotFound)
+}
+
+func testConcurrentUpdates(t *testing.T, s database.Storage) {
+	const workers = 20
+
+	alias := newAlias()
+
+	_, err := s.SaveURL(database.Link{URL: "https://google.com", Alias: alias})
+	require.NoError(t, err)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		errs     []error
+		previous = make(map[string]int)
+		targets  = make(map[string]struct{})
+	)
+
+	for i := 0; i < workers; i++ {
+		target := fmt.Sprintf("https://google.com/%d", i)
+		targets[target] = struct{}{}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			prev, err := s.UpdateURL(alias, target)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			previous[prev]++
+		}()
+	}
+	wg.Wait()
+
+	require.Empty(t, errs)
+
+	// every url but the final one was replaced exactly once
+	got, err := s.GetURL(alias)
+	require.NoError(t, err)
+	require.Contains(t, targets, got.URL)
+	require.NotContains(t, previous, got.URL)
+	for url, n := range previous {
+		require.Equal(t, 1, n, "%s was replaced %d times", url, n)
+	}
+
+	history, err := s.GetHistory(alias)
+	require.NoError(t, err)
+	require.Len(t, history, workers)
+}
+
+func testDeleteRemovesHistory(t *testing.T, s database.Storage) {
+	alias := newAlias()
+
+	_, err := s.SaveURL(database.Link{URL: "https://google.com", Alias: alias})
+	require.NoError(t, err)
+	_, err = s.UpdateURL(alias, "https://yandex.ru")
+	require.NoError(t, err)
+
+	require.NoError(t, s.DeleteURL(alias))
+
+	_, err = s.SaveURL(database.Link{URL: "https://bing.com", Alias: alias})
+	require.NoError(t, err)
+
+	history, err := s.GetHistory(alias)
+	require.NoError(t, err)
+	require.Empty(t, history, "a reused alias must not inherit history")
+}
+
+func testCreatedAt(t *testing.T, s database.Storage) {
+	alias := newAlias()
+
+	_, err := s.SaveURL(database.Link{URL: "https://google.com", Alias: alias})
+	require.NoError(t, err)
+
+	got, err := s.GetURL(alias)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now(), got.CreatedAt, time.Minute)
+}
+
+// listAll walks every page of the filter and returns the aliases in order
+func listAll(t *testing.T, s database.Storage, filter database.ListFilter) []string {
+	var aliases []string
+
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 100, "pagination does not end")
+
+		links, err := s.ListURLs(filter)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(links), filter.Limit)
+
+		for _, link := range links {
+			aliases = append(aliases, link.Alias)
+		}
+		if len(links) < filter.Limit {
+			return aliases
+		}
+		filter.Cursor = links[len(links)-1].ID
+	}
+}
+
+func testListPages(t *testing.T, s database.Storage) {
+	prefix := newAlias()
+
+	var saved []string
+	for i := 0; i < 5; i++ {
+		alias := fmt.Sprintf("%s_%d", prefix, i)
+		_, err := s.SaveURL(database.Link{URL: "https://google.com", Alias: alias})
+		require.NoError(t, err)
+		saved = append(saved, alias)
+	}
+
+	asc := listAll(t, s, database.ListFilter{AliasPrefix: prefix, Limit: 2})
+	require.Equal(t, saved, asc)
+
+	desc := listAll(t, s, database.ListFilter{AliasPrefix: prefix, Limit: 2, Desc: true})
+	for i, j := 0, len(saved)-1; i < j; i, j = i+1, j-1 {
+		saved[i], saved[j] = saved[j], saved[i]
+	}
+	require.Equal(t, saved, desc)
+
+	links, err := s.ListURLs(database.ListFilter{AliasPrefix: prefix, Limit: 3})
+	require.NoError(t, err)
+	require.Len(t, links, 3)
+	require.Equal(t, "https://google.com", links[0].URL)
+	require.False(t, links[0].CreatedAt.IsZero())
+}
+
+func testListFilters(t *testing.T, s database.Storage) {
+	prefix := newAlias()
+	marker := newAlias()
+
+	links := []database.Link{
+		{Alias: prefix + "_a", URL: "https://google.com/" + marker},
+		{Alias: prefix + "_b", URL: "https://yandex.ru/" + marker},
+		{Alias: prefix + "%_c", URL: "https://google.com/other"},
+		{Alias: "x" + prefix, URL: "https://google.com/" + marker},
+	}
+	for _, link := range links {
+		_, err := s.SaveURL(link)
+		require.NoError(t, err)
+	}
+
+	got := listAll(t, s, database.ListFilter{AliasPrefix: prefix, Limit: 10})
+	require.Equal(t, []string{prefix + "_a", prefix + "_b", prefix + "%_c"}, got)
+
+	got = listAll(t, s, database.ListFilter{AliasPrefix: prefix + "%", Limit: 10})
+	require.Equal(t, []string{prefix + "%_c"}, got, "wildcards in the prefix must be literal")
+
+	got = listAll(t, s, database.ListFilter{URLContains: marker, Limit: 10})
+	require.Equal(t, []string{prefix + "_a", prefix + "_b", "x" + prefix}, got)
+
+	got = listAll(t, s, database.ListFilter{AliasPrefix: prefix, URLContains: "google.com/" + marker, Limit: 10})
+	require.Equal(t, []string{prefix + "_a"}, got)
+
+	got = listAll(t, s, database.ListFilter{URLContains: strings.ToUpper(marker), Limit: 10})
+	require.Empty(t, got, "matching is case sensitive")
+}
+
+func testSaveURLs(t *testing.T, s database.Storage) {
+	taken, prefix := newAlias(), newAlias()
+
+	_, err := s.SaveURL(database.Link{URL: "https://google.com", Alias: taken})
+	require.NoError(t, err)
+
+	first, second := newAlias(), newAlias()
+	expiresAt := time.Now().Add(time.Hour)
+
+	results, err := s.SaveURLs([]database.Link{
+		{URL: "https://yandex.ru", Alias: first, ExpiresAt: &expiresAt},
+		{URL: "https://yandex.ru", Alias: taken},
+		{URL: "https://bing.com", Alias: second},
+		{URL: "https://bing.com", Alias: second},
+		{URL: "https://duckduckgo.com"},
+	}, idAlias(prefix))
+	require.NoError(t, err)
+	require.Len(t, results, 5)
+
+	require.NoError(t, results[0].Err)
+	require.NotZero(t, results[0].ID)
+	require.ErrorIs(t, results[1].Err, database.ErrURLAlreadyExists)
+	require.NoError(t, results[2].Err)
+	require.NotEqual(t, results[0].ID, results[2].ID)
+	require.ErrorIs(t, results[3].Err, database.ErrURLAlreadyExists, "duplicates inside the batch must be reported")
+	require.NoError(t, results[4].Err)
+	require.Equal(t, first, results[0].Alias)
+	require.Equal(t, prefix+strconv.FormatInt(results[4].ID, 10), results[4].Alias)
+
+	got, err := s.GetURL(first)
+	require.NoError(t, err)
+	require.Equal(t, results[0].ID, got.ID)
+	require.NotNil(t, got.ExpiresAt)
+	require.False(t, got.CreatedAt.IsZero())
+
+	got, err = s.GetURL(taken)
+	require.NoError(t, err)
+	require.Equal(t, "https://google.com", got.URL, "a taken alias must keep its url")
+
+	got, err = s.GetURL(second)
+	require.NoError(t, err)
+	require.Equal(t, "https://bing.com", got.URL)
+
+	got, err = s.GetURL(results[4].Alias)
+	require.NoError(t, err)
+	require.Equal(t, results[4].ID, got.ID)
+}
+
+// idAlias generates aliases from row ids the way the sequential strategy does
+func idAlias(prefix string) database.AliasFunc {
+	return func(id int64, _ int) (string, error) {
+		return prefix + strconv.FormatInt(id, 10), nil
+	}
+}
+
+func testSaveGeneratedURL(t *testing.T, s database.Storage) {
+	prefix := newAlias()
+	expiresAt := time.Now().Add(time.Hour)
+
+	link, err := s.SaveGeneratedURL(database.Link{URL: "https://google.com", Alias: "ignored", ExpiresAt: &expiresAt}, idAlias(prefix))
+	require.NoError(t, err)
+	require.NotZero(t, link.ID)
+	require.Equal(t, prefix+strconv.FormatInt(link.ID, 10), link.Alias)
+	require.False(t, link.CreatedAt.IsZero())
+
+	got, err := s.GetURL(link.Alias)
+	require.NoError(t, err)
+	require.Equal(t, link.ID, got.ID)
+	require.Equal(t, "https://google.com", got.URL)
+	require.NotNil(t, got.ExpiresAt)
+
+	_, err = s.GetURL("ignored")
+	require.ErrorIs(t, err, database.ErrURLNotFound)
+
+	taken := newAlias()
+	_, err = s.SaveURL(database.Link{URL: "https://google.com", Alias: taken})
+	require.NoError(t, err)
+
+	fresh := newAlias()
+	link, err = s.SaveGeneratedURL(database.Link{URL: "https://yandex.ru"}, func(_ int64, attempt int) (string, error) {
+		if attempt < 2 {
+			return taken, nil
+		}
+		return fresh, nil
+	})
+	require.NoError(t, err, "taken aliases must be retried")
+	require.Equal(t, fresh, link.Alias)
+
+	calls := 0
+	_, err = s.SaveGeneratedURL(database.Link{URL: "https://yandex.ru"}, func(int64, int) (string, error) {
+		calls++
+		return taken, nil
+	})
+	require.ErrorIs(t, err, database.ErrAliasExhausted)
+	require.Equal(t, database.AliasAttempts, calls)
+
+	got, err = s.GetURL(taken)
+	require.NoError(t, err)
+	require.Equal(t, "https://google.com", got.URL, "a taken alias must keep its url")
+
+	errGen := errors.New("generator failed")
+	_, err = s.SaveGeneratedURL(database.Link{URL: "https://yandex.ru"}, func(int64, int) (string, error) {
+		return "", errGen
+	})
+	require.ErrorIs(t, err, errGen)
+}
+
+// testGeneratedSkipsTakenID covers id based aliases colliding with a custom alias
+func testGeneratedSkipsTakenID(t *testing.T, s database.Storage) {
+	prefix := newAlias()
+
+	first, err := s.SaveGeneratedURL(database.Link{URL: "https://google.com"}, idAlias(prefix))
+	require.NoError(t, err)
+
+	taken := prefix + strconv.FormatInt(first.ID+2, 10) // the custom alias itself takes id first.ID+1
+	_, err = s.SaveURL(database.Link{URL: "https://google.com", Alias: taken})
+	require.NoError(t, err)
+
+	link, err := s.SaveGeneratedURL(database.Link{URL: "https://yandex.ru"}, idAlias(prefix))
+	require.NoError(t, err)
+	require.NotEqual(t, taken, link.Alias)
+	require.Equal(t, prefix+strconv.FormatInt(link.ID, 10), link.Alias)
+}
+
+// testGeneratedSkipsRejected covers aliases the AliasFunc refuses, like reserved words
+func testGeneratedSkipsRejected(t *testing.T, s database.Storage) {
+	rejected := newAlias()
+	newAlias := func(id int64, attempt int) (string, error) {
+		if attempt == 0 {
+			return "", fmt.Errorf("%w: %q is reserved", database.ErrAliasRejected, rejected)
+		}
+		return rejected + strconv.Itoa(attempt), nil
+	}
+
+	link, err := s.SaveGeneratedURL(database.Link{URL: "https://google.com"}, newAlias)
+	require.NoError(t, err)
+	require.Equal(t, rejected+"1", link.Alias)
+
+	results, err := s.SaveURLs([]database.Link{{URL: "https://yandex.ru"}}, func(id int64, attempt int) (string, error) {
+		if attempt < 2 {
+			return "", database.ErrAliasRejected
+		}
+		return rejected + "bulk", nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, results[0].Err)
+	require.Equal(t, rejected+"bulk", results[0].Alias)
+
+	_, err = s.SaveGeneratedURL(database.Link{URL: "https://google.com"}, func(int64, int) (string, error) {
+		return "", database.ErrAliasRejected
+	})
+	require.ErrorIs(t, err, database.ErrAliasExhausted)
+}
+
+func testConcurrentGeneratedSaves(t *testing.T, s database.Storage) {
+	const workers = 20
+
+	prefix := newAlias()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.SaveGeneratedURL(database.Link{URL: "https://google.com"}, idAlias(prefix))
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err, "every save must get its own id")
+	}
+
+	got, err := s.ListURLs(database.ListFilter{AliasPrefix: prefix, Limit: workers + 1})
+	require.NoError(t, err)
+	require.Len(t, got, workers)
+}
+
+func testFindOrSaveGeneratedURL(t *testing.T, s database.Storage) {
+	prefix := newAlias()
+	url := "https://google.com/" + newAlias()
+
+	custom := newAlias()
+	_, err := s.SaveURL(database.Link{URL: url, Alias: custom})
+	require.NoError(t, err)
+
+	first, found, err := s.FindOrSaveGeneratedURL(database.Link{URL: url}, idAlias(prefix))
+	require.NoError(t, err)
+	require.False(t, found, "custom aliases are never reused")
+	require.True(t, first.Generated)
+	require.NotEqual(t, custom, first.Alias)
+
+	again, found, err := s.FindOrSaveGeneratedURL(database.Link{URL: url}, idAlias(prefix))
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, first.ID, again.ID)
+	require.Equal(t, first.Alias, again.Alias)
+
+	expiresAt := time.Now().Add(time.Hour)
+	expiring, found, err := s.FindOrSaveGeneratedURL(database.Link{URL: url, ExpiresAt: &expiresAt}, idAlias(prefix))
+	require.NoError(t, err)
+	require.False(t, found, "links with an expiry are never reused")
+	require.NotEqual(t, first.Alias, expiring.Alias)
+
+	other, found, err := s.FindOrSaveGeneratedURL(database.Link{URL: url + "/other"}, idAlias(prefix))
+	require.NoError(t, err)
+	require.False(t, found)
+	require.NotEqual(t, first.Alias, other.Alias)
+
+	got, err := s.GetURL(first.Alias)
+	require.NoError(t, err)
+	require.True(t, got.Generated)
+
+	got, err = s.GetURL(custom)
+	require.NoError(t, err)
+	require.False(t, got.Generated)
+}
+
+func testConcurrentFindOrSave(t *testing.T, s database.Storage) {
+	const workers = 10
+
+	prefix := newAlias()
+	url := "https://google.com/" + newAlias()
+
+	var wg sync.WaitGroup
+	aliases := make(chan string, workers)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			link, _, err := s.FindOrSaveGeneratedURL(database.Link{URL: url}, idAlias(prefix))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			aliases <- link.Alias
+		}()
+	}
+	wg.Wait()
+	close(aliases)
+
+	seen := make(map[string]bool)
+	for alias := range aliases {
+		seen[alias] = true
+	}
+	require.Len(t, seen, 1, "one url must get one alias")
+}
+
+func testRedirectCode(t *testing.T, s database.Storage) {
+	prefix := newAlias()
+	url := "https://google.com/" + newAlias()
+
+	custom := newAlias()
+	_, err := s.SaveURL(database.Link{URL: url, Alias: custom, RedirectCode: http.StatusMovedPermanently})
+	require.NoError(t, err)
+
+	got, err := s.GetURL(custom)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusMovedPermanently, got.RedirectCode)
+
+	plain, err := s.SaveGeneratedURL(database.Link{URL: url}, idAlias(prefix))
+	require.NoError(t, err)
+
+	got, err = s.GetURL(plain.Alias)
+	require.NoError(t, err)
+	require.Zero(t, got.RedirectCode)
+
+	// a reused alias must redirect the way the client asked for
+	permanent, found, err := s.FindOrSaveGeneratedURL(database.Link{URL: url, RedirectCode: http.StatusPermanentRedirect}, idAlias(prefix))
+	require.NoError(t, err)
+	require.False(t, found)
+	require.NotEqual(t, plain.Alias, permanent.Alias)
+
+	again, found, err := s.FindOrSaveGeneratedURL(database.Link{URL: url, RedirectCode: http.StatusPermanentRedirect}, idAlias(prefix))
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, permanent.Alias, again.Alias)
+	require.Equal(t, http.StatusPermanentRedirect, again.RedirectCode)
+
+	bulk := newAlias()
+	results, err := s.SaveURLs([]database.Link{
+		{URL: url, Alias: bulk, RedirectCode: http.StatusTemporaryRedirect},
+		{URL: url, RedirectCode: http.StatusSeeOther},
+	}, idAlias(prefix))
+	require.NoError(t, err)
+
+	for i, want := range []int{http.StatusTemporaryRedirect, http.StatusSeeOther} {
+		require.NoError(t, results[i].Err)
+
+		got, err := s.GetURL(results[i].Alias)
+		require.NoError(t, err)
+		require.Equal(t, want, got.RedirectCode)
+	}
+}
+
+func testForwarding(t *testing.T, s database.Storage) {
+	prefix := newAlias()
+	url := "https://docs.example.com/" + newAlias()
+
+	custom := newAlias()
+	_, err := s.SaveURL(database.Link{URL: url, Alias: custom, ForwardQuery: true, ForwardPath: true})
+	require.NoError(t, err)
+
+	got, err := s.GetURL(custom)
+	require.NoError(t, err)
+	require.True(t, got.ForwardQuery)
+	require.True(t, got.ForwardPath)
+
+	plain, _, err := s.FindOrSaveGeneratedURL(database.Link{URL: url}, idAlias(prefix))
+	require.NoError(t, err)
+	require.False(t, plain.ForwardPath)
+
+	forwarding, found, err := s.FindOrSaveGeneratedURL(database.Link{URL: url, ForwardPath: true}, idAlias(prefix))
+	require.NoError(t, err)
+	require.False(t, found, "links forwarding differently are never reused")
+	require.NotEqual(t, plain.Alias, forwarding.Alias)
+
+	results, err := s.SaveURLs([]database.Link{{URL: url, ForwardQuery: true}}, idAlias(prefix))
+	require.NoError(t, err)
+	require.NoError(t, results[0].Err)
+
+	got, err = s.GetURL(results[0].Alias)
+	require.NoError(t, err)
+	require.True(t, got.ForwardQuery)
+	require.False(t, got.ForwardPath)
+}
+
+func testParams(t *testing.T, s database.Storage) {
+	prefix := newAlias()
+	url := "https://shop.example.com/" + newAlias()
+	params := map[string]string{"utm_source": "newsletter", "utm_campaign": "{alias}-{date}", "a b": "c&d"}
+
+	custom := newAlias()
+	_, err := s.SaveURL(database.Link{URL: url, Alias: custom, Params: params})
+	require.NoError(t, err)
+
+	got, err := s.GetURL(custom)
+	require.NoError(t, err)
+	require.Equal(t, params, got.Params)
+
+	plain, _, err := s.FindOrSaveGeneratedURL(database.Link{URL: url}, idAlias(prefix))
+	require.NoError(t, err)
+	require.Empty(t, plain.Params)
+
+	tagged, found, err := s.FindOrSaveGeneratedURL(database.Link{URL: url, Params: params}, idAlias(prefix))
+	require.NoError(t, err)
+	require.False(t, found, "links with other params are never reused")
+	require.NotEqual(t, plain.Alias, tagged.Alias)
+
+	again, found, err := s.FindOrSaveGeneratedURL(database.Link{URL: url, Params: params}, idAlias(prefix))
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, tagged.Alias, again.Alias)
+	require.Equal(t, params, again.Params)
+}
+
+func testPasswordHash(t *testing.T, s database.Storage) {
+	prefix := newAlias()
+	url := "https://docs.example.com/" + newAlias()
+
+	plain, _, err := s.FindOrSaveGeneratedURL(database.Link{URL: url}, idAlias(prefix))
+	require.NoError(t, err)
+	require.Empty(t, plain.PasswordHash)
+
+	locked, found, err := s.FindOrSaveGeneratedURL(database.Link{URL: url, PasswordHash: "hash"}, idAlias(prefix))
+	require.NoError(t, err)
+	require.False(t, found, "an open link is never reused for a locked one")
+	require.NotEqual(t, plain.Alias, locked.Alias)
+
+	got, err := s.GetURL(locked.Alias)
+	require.NoError(t, err)
+	require.Equal(t, "hash", got.PasswordHash)
+}
+
+func testVisits(t *testing.T, s database.Storage) {
+	const limit, visitors = 3, 10
+
+	alias := newAlias()
+	left := limit
+	_, err := s.SaveURL(database.Link{URL: "https://example.com/invite", Alias: alias, VisitsLeft: &left})
+	require.NoError(t, err)
+
+	got, err := s.GetURL(alias)
+	require.NoError(t, err)
+	require.NotNil(t, got.VisitsLeft)
+	require.Equal(t, limit, *got.VisitsLeft)
+
+	var (
+		wg              sync.WaitGroup
+		mu              sync.Mutex
+		used, exhausted int
+		errs            []error
+	)
+	for range visitors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := s.UseVisit(alias)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				used++
+			case errors.Is(err, database.ErrNoVisitsLeft):
+				exhausted++
+			default:
+				errs = append(errs, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Empty(t, errs)
+	require.Equal(t, limit, used, "concurrent visits never take more than the limit")
+	require.Equal(t, visitors-limit, exhausted)
+
+	got, err = s.GetURL(alias)
+	require.NoError(t, err)
+	require.True(t, got.UsedUp())
+
+	require.ErrorIs(t, s.UseVisit(alias), database.ErrNoVisitsLeft)
+	require.ErrorIs(t, s.UseVisit(newAlias()), database.ErrNoVisitsLeft)
+
+	// limited links are never reused
+	prefix := newAlias()
+	once := 1
+	first, _, err := s.FindOrSaveGeneratedURL(database.Link{URL: "https://example.com/reset", VisitsLeft: &once}, idAlias(prefix))
+	require.NoError(t, err)
+	second, found, err := s.FindOrSaveGeneratedURL(database.Link{URL: "https://example.com/reset", VisitsLeft: &once}, idAlias(prefix))
+	require.NoError(t, err)
+	require.False(t, found)
+	require.NotEqual(t, first.Alias, second.Alias)
+}
+
+func testActiveFrom(t *testing.T, s database.Storage) {
+	launch := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	alias := newAlias()
+	_, err := s.SaveURL(database.Link{URL: "https://example.com/launch", Alias: alias, ActiveFrom: &launch})
+	require.NoError(t, err)
+
+	got, err := s.GetURL(alias)
+	require.NoError(t, err)
+	require.NotNil(t, got.ActiveFrom)
+	require.True(t, launch.Equal(*got.ActiveFrom))
+	require.False(t, got.Active(time.Now()))
+	require.True(t, got.Active(launch))
+
+	// scheduled links are never reused
+	prefix := newAlias()
+	first, _, err := s.FindOrSaveGeneratedURL(database.Link{URL: "https://example.com/launch", ActiveFrom: &launch}, idAlias(prefix))
+	require.NoError(t, err)
+	second, found, err := s.FindOrSaveGeneratedURL(database.Link{URL: "https://example.com/launch", ActiveFrom: &launch}, idAlias(prefix))
+	require.NoError(t, err)
+	require.False(t, found)
+	require.NotEqual(t, first.Alias, second.Alias)
+}
@@ -0,0 +1,169 @@
+package urlbulk
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/alias"
+	"github.com/FacelessWayfarer/urlshortner/internal/database"
+	urlsave "github.com/FacelessWayfarer/urlshortner/internal/handlers/url-save"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/response"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/slogg"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+// Request is a JSON array of the items POST /url accepts
+type Request []urlsave.Request
+
+type Response struct {
+	response.Response
+	Results []urlsave.Response `json:"results,omitempty"` // one per request item, in the same order
+}
+
+type URLBulkSaver interface {
+	SaveURLs(links []database.Link, newAlias database.AliasFunc) ([]database.SaveResult, error)
+}
+
+// maxItems caps the items of one request
+const maxItems = 1000
+
+// maxBodyBytes bounds the request body, a thousand items fit in it with room to spare
+const maxBodyBytes = 4 << 20
+
+// maxProtectedItems caps the items with a password one request may save, every password
+// is hashed with bcrypt in turn and hundreds of them would outlast the server write timeout
+const maxProtectedItems = 20
+
+// New serves POST /url/bulk, valid items are saved in one transaction
+// and every item gets its own result. Deduplication does not apply to bulk saves.
+// A request takes from 1 to maxItems items, at most maxProtectedItems of them with a password,
+// other requests are refused as a whole with a 400 before anything is saved.
+func New(log *slog.Logger, urlSaver URLBulkSaver, aliasGen alias.Generator, opts urlsave.Options) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const mark = "handlers.url-bulk.New"
+
+		log := log.With(
+			slog.String("mark", mark),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req Request
+
+		if err := render.DecodeJSON(http.MaxBytesReader(w, r.Body, maxBodyBytes), &req); err != nil {
+			if errors.Is(err, io.EOF) {
+				log.Error("request body is empty")
+
+				response.JSON(w, r, response.Error("empty request"))
+
+				return
+			}
+			log.Error("failed to decode request body", slogg.Err(err))
+
+			response.JSON(w, r, response.Error("failed to decode request"))
+
+			return
+		}
+
+		if len(req) == 0 || len(req) > maxItems {
+			log.Info("invalid number of items", slog.Int("items", len(req)))
+
+			response.JSON(w, r, response.Error("request must contain from 1 to "+strconv.Itoa(maxItems)+" items"))
+
+			return
+		}
+
+		protected := 0
+		for _, item := range req {
+			if item.Password != "" {
+				protected++
+			}
+		}
+		if protected > maxProtectedItems {
+			log.Info("too many items with a password", slog.Int("protected", protected))
+
+			response.JSON(w, r, response.Error("request may contain at most "+strconv.Itoa(maxProtectedItems)+" items with a password"))
+
+			return
+		}
+
+		log.Info("request body decoded", slog.Int("items", len(req)))
+
+		results := make([]urlsave.Response, len(req))
+
+		// links holds the valid items, index maps them back to their place in the request
+		links := make([]database.Link, 0, len(req))
+		index := make([]int, 0, len(req))
+
+		now := time.Now()
+
+		for i, item := range req {
+			link, err := urlsave.Build(item, now, opts)
+			if err != nil {
+				var reqErr *urlsave.RequestError
+				if errors.As(err, &reqErr) {
+					results[i] = urlsave.Response{Response: reqErr.Response()}
+					continue
+				}
+				log.Error("failed to build link", slogg.Err(err))
+
+				results[i] = urlsave.Response{Response: response.Internal("failed to add url")}
+				continue
+			}
+
+			links = append(links, link) // empty aliases are generated by the storage
+			index = append(index, i)
+		}
+
+		if len(links) > 0 {
+			saved, err := urlSaver.SaveURLs(links, urlsave.GenerateAlias(aliasGen, opts.Aliases))
+			if err != nil {
+				log.Error("failed to add urls", slogg.Err(err))
+
+				response.JSON(w, r, response.Internal("failed to add urls"))
+
+				return
+			}
+
+			for j, res := range saved {
+				i := index[j]
+
+				switch {
+				case errors.Is(res.Err, database.ErrURLAlreadyExists):
+					results[i] = urlsave.Response{Response: response.Error("url already exists")}
+				case errors.Is(res.Err, database.ErrAliasExhausted):
+					results[i] = urlsave.Response{Response: response.Error("failed to generate a free alias, try again or set one")}
+				case res.Err != nil:
+					log.Error("failed to add url", slogg.Err(res.Err))
+
+					results[i] = urlsave.Response{Response: response.Internal("failed to add url")}
+				default:
+					results[i] = urlsave.Response{
+						Response:     response.OK(),
+						Alias:        res.Alias,
+						URL:          links[j].URL,
+						ExpiresAt:    links[j].ExpiresAt,
+						ActiveFrom:   links[j].ActiveFrom,
+						Redirect:     links[j].RedirectCode,
+						ForwardQuery: links[j].ForwardQuery,
+						ForwardPath:  links[j].ForwardPath,
+						Params:       links[j].Params,
+						Protected:    links[j].PasswordHash != "",
+						VisitsLeft:   links[j].VisitsLeft,
+					}
+				}
+			}
+		}
+
+		log.Info("bulk request processed", slog.Int("items", len(req)), slog.Int("valid", len(links)))
+
+		response.JSON(w, r, Response{
+			Response: response.OK(),
+			Results:  results,
+		})
+	}
+}
@@ -1,14 +1,15 @@
 package urldelete
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
 
+	"github.com/FacelessWayfarer/urlshortner/internal/database"
 	"github.com/FacelessWayfarer/urlshortner/internal/lib/response"
 	"github.com/FacelessWayfarer/urlshortner/internal/lib/slogg"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/render"
 )
 
 type URLRemover interface {
@@ -29,21 +30,29 @@ func New(log *slog.Logger, URLRemover URLRemover) http.HandlerFunc {
 		if alias == "" {
 			log.Info("alias is empty")
 
-			render.JSON(w, r, response.Error("invalid request"))
+			response.JSON(w, r, response.Error("invalid request"))
 
 			return
 		}
 
 		err := URLRemover.DeleteURL(alias)
 		if err != nil {
+			if errors.Is(err, database.ErrURLNotFound) {
+				log.Info("url not found", "alias", alias)
+
+				response.JSON(w, r, response.NotFound("not found"))
+
+				return
+			}
 			log.Error("failed to remove url", slogg.Err(err))
 
-			render.JSON(w, r, response.Error("internal error"))
+			response.JSON(w, r, response.Internal("internal error"))
 
 			return
 		}
 
 		log.Info("removed url")
 
+		response.JSON(w, r, response.OK())
 	}
 }
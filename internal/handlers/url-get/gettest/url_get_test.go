@@ -3,15 +3,23 @@ package gettests
 import (
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
+	"github.com/FacelessWayfarer/urlshortner/internal/database"
 	urlget "github.com/FacelessWayfarer/urlshortner/internal/handlers/url-get"
 	"github.com/FacelessWayfarer/urlshortner/internal/handlers/url-save/test/mocks"
 	discardslogg "github.com/FacelessWayfarer/urlshortner/internal/lib/discard-slogg"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/linklock"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/selflink"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/urlpolicy"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/assert/v2"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -20,33 +28,141 @@ func TestGetHandle(t *testing.T) {
 		name      string
 		alias     string
 		url       string
-		respError string
+		expiresAt *time.Time
+		redirect  int // stored redirect code of the link
+		respCode  int
 		mockError error
+		// visitsLeft of the link, a visit is taken with visitErr unless the link is refused before
+		visitsLeft *int
+		visitErr   error
+		activeFrom *time.Time
 	}{
 		{
 			name:  "Success",
 			alias: "test_alias",
 			url:   "https://www.google.com/",
 		},
+		{
+			name:      "Not expired yet",
+			alias:     "test_alias",
+			url:       "https://www.google.com/",
+			expiresAt: timePtr(time.Now().Add(time.Hour)),
+		},
+		{
+			name:      "Expired",
+			alias:     "test_alias",
+			url:       "https://www.google.com/",
+			expiresAt: timePtr(time.Now().Add(-time.Hour)),
+			respCode:  http.StatusGone,
+		},
+		{
+			name:      "Not found",
+			alias:     "test_alias",
+			mockError: database.ErrURLNotFound,
+			respCode:  http.StatusNotFound,
+		},
+		{
+			name:     "Permanent redirect",
+			alias:    "test_alias",
+			url:      "https://www.google.com/",
+			redirect: http.StatusMovedPermanently,
+		},
+		{
+			name:       "Not active yet",
+			alias:      "test_alias",
+			url:        "https://www.google.com/",
+			activeFrom: timePtr(time.Now().Add(time.Hour)),
+			respCode:   http.StatusNotFound,
+		},
+		{
+			name:       "Active since launch",
+			alias:      "test_alias",
+			url:        "https://www.google.com/",
+			activeFrom: timePtr(time.Now().Add(-time.Hour)),
+		},
+		{
+			name:       "Last visit",
+			alias:      "test_alias",
+			url:        "https://www.google.com/",
+			visitsLeft: intPtr(1),
+		},
+		{
+			name:       "Used up",
+			alias:      "test_alias",
+			url:        "https://www.google.com/",
+			visitsLeft: intPtr(0),
+			respCode:   http.StatusGone,
+		},
+		{
+			name:       "Used up by a concurrent visit",
+			alias:      "test_alias",
+			url:        "https://www.google.com/",
+			visitsLeft: intPtr(1),
+			visitErr:   database.ErrNoVisitsLeft,
+			respCode:   http.StatusGone,
+		},
+		{
+			name:     "Blocked by policy",
+			alias:    "test_alias",
+			url:      "http://127.0.0.1/admin",
+			respCode: http.StatusForbidden,
+		},
+		{
+			name:     "Points at itself",
+			alias:    "test_alias",
+			url:      "https://sho.rt/test_alias",
+			respCode: http.StatusLoopDetected,
+		},
 	}
 
+	policy, err := urlpolicy.New(urlpolicy.Config{BlockPrivate: true})
+	require.NoError(t, err)
+
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			urlGetterMock := mocks.NewURLGetter(t)
+			clickRecorderMock := mocks.NewClickRecorder(t)
+
+			urlGetterMock.On("GetURL", tc.alias).
+				Return(database.Link{Alias: tc.alias, URL: tc.url, ExpiresAt: tc.expiresAt, RedirectCode: tc.redirect, VisitsLeft: tc.visitsLeft, ActiveFrom: tc.activeFrom}, tc.mockError).
+				Once()
 
-			if tc.respError == "" || tc.mockError != nil {
-				urlGetterMock.On("GetURL", tc.alias).Return(tc.url, tc.mockError).Once()
+			visitCounterMock := mocks.NewVisitCounter(t)
+			if tc.visitsLeft != nil && *tc.visitsLeft > 0 {
+				visitCounterMock.On("UseVisit", tc.alias).Return(tc.visitErr).Once()
 			}
 
+			if tc.respCode == 0 {
+				clickRecorderMock.On("Record", mock.MatchedBy(func(c database.Click) bool {
+					return c.Alias == tc.alias && c.UserAgent == "Go-http-client/1.1" && !c.ClickedAt.IsZero()
+				})).Once()
+			}
+
+			selfLinks := selflink.New(selflink.Config{Hosts: []string{"sho.rt"}}, urlGetterMock)
+
 			r := chi.NewRouter()
-			r.Get("/{alias}", urlget.New(discardslogg.NewDiscardLogger(), urlGetterMock))
+			r.Get("/{alias}", urlget.New(discardslogg.NewDiscardLogger(), urlGetterMock, visitCounterMock, clickRecorderMock, urlget.Options{
+				Policy:       policy,
+				SelfLinks:    selfLinks,
+				RedirectCode: http.StatusTemporaryRedirect,
+			}))
 
 			ts := httptest.NewServer(r)
 			defer ts.Close()
 
 			// ts.URL = "http://127.0.0.1:6060"
 			t.Log(ts.URL + "/" + tc.alias)
-			redirectedToURL, err := GetRedirectTest(ts.URL + "/" + tc.alias)
+			wantCode := tc.redirect
+			if wantCode == 0 {
+				wantCode = http.StatusTemporaryRedirect
+			}
+
+			redirectedToURL, err := GetRedirectTest(ts.URL+"/"+tc.alias, wantCode)
+
+			if tc.respCode != 0 {
+				require.ErrorContains(t, err, fmt.Sprint(tc.respCode))
+				return
+			}
 			require.NoError(t, err)
 
 			// Check the final URL after redirection.
@@ -56,8 +172,171 @@ func TestGetHandle(t *testing.T) {
 	}
 }
 
-// GetRedirectTest returns the final URL after redirection.
-func GetRedirectTest(url string) (string, error) {
+func TestGetHandle_Forwarding(t *testing.T) {
+	cases := []struct {
+		name     string
+		link     database.Link
+		path     string // requested after the host
+		location string
+		respCode int
+		badPath  bool // refused before the link is looked up
+	}{
+		{
+			name:     "Query forwarded",
+			link:     database.Link{URL: "https://docs.example.com/v2/", ForwardQuery: true},
+			path:     "/docs?ref=x&b=2",
+			location: "https://docs.example.com/v2/?ref=x&b=2",
+		},
+		{
+			name:     "Stored parameters win",
+			link:     database.Link{URL: "https://docs.example.com/?ref=site", ForwardQuery: true},
+			path:     "/docs?lang=en&ref=x",
+			location: "https://docs.example.com/?ref=site&lang=en",
+		},
+		{
+			name:     "Query dropped",
+			link:     database.Link{URL: "https://docs.example.com/v2/"},
+			path:     "/docs?ref=x",
+			location: "https://docs.example.com/v2/",
+		},
+		{
+			name:     "Path forwarded",
+			link:     database.Link{URL: "https://docs.example.com/v2/", ForwardPath: true, ForwardQuery: true},
+			path:     "/docs/guide/page.html?ref=x",
+			location: "https://docs.example.com/v2/guide/page.html?ref=x",
+		},
+		{
+			name:     "Escaped path kept",
+			link:     database.Link{URL: "https://docs.example.com/v2", ForwardPath: true},
+			path:     "/docs/a%2Fb/c%20d",
+			location: "https://docs.example.com/v2/a%2Fb/c%20d",
+		},
+		{
+			name:     "Params added",
+			link:     database.Link{URL: "https://docs.example.com/?utm_source=site", ForwardQuery: true, Params: map[string]string{"utm_source": "mail", "utm_campaign": "{alias}"}},
+			path:     "/docs?utm_campaign=spoofed&ref=x",
+			location: "https://docs.example.com/?utm_source=site&utm_campaign=docs&ref=x",
+		},
+		{
+			name:     "Path on a link without forwarding",
+			link:     database.Link{URL: "https://docs.example.com/v2/"},
+			path:     "/docs/guide",
+			respCode: http.StatusNotFound,
+		},
+		{
+			name:     "Dot segments refused",
+			link:     database.Link{URL: "https://docs.example.com/v2/", ForwardPath: true},
+			path:     "/docs/%2e%2e/admin",
+			respCode: http.StatusNotFound,
+			badPath:  true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			urlGetterMock := mocks.NewURLGetter(t)
+			clickRecorderMock := mocks.NewClickRecorder(t)
+
+			tc.link.Alias = "docs"
+			if !tc.badPath {
+				urlGetterMock.On("GetURL", "docs").Return(tc.link, nil).Once()
+			}
+			if tc.respCode == 0 {
+				clickRecorderMock.On("Record", mock.Anything).Once()
+			}
+
+			handler := urlget.New(discardslogg.NewDiscardLogger(), urlGetterMock, mocks.NewVisitCounter(t), clickRecorderMock, urlget.Options{})
+
+			r := chi.NewRouter()
+			r.Get("/{alias}", handler)
+			r.Get("/{alias}/*", handler)
+
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			location, err := GetRedirectTest(ts.URL+tc.path, http.StatusFound)
+
+			if tc.respCode != 0 {
+				require.ErrorContains(t, err, fmt.Sprint(tc.respCode))
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.location, location)
+		})
+	}
+}
+
+func TestGetHandle_Password(t *testing.T) {
+	hash, err := linklock.Hash("s3cret")
+	require.NoError(t, err)
+
+	urlGetterMock := mocks.NewURLGetter(t)
+	clickRecorderMock := mocks.NewClickRecorder(t)
+
+	urlGetterMock.On("GetURL", "docs").
+		Return(database.Link{Alias: "docs", URL: "https://docs.example.com/", PasswordHash: hash, RedirectCode: http.StatusPermanentRedirect}, nil)
+	clickRecorderMock.On("Record", mock.Anything).Once()
+
+	handler := urlget.New(discardslogg.NewDiscardLogger(), urlGetterMock, mocks.NewVisitCounter(t), clickRecorderMock, urlget.Options{MaxAttempts: 3})
+
+	r := chi.NewRouter()
+	r.Get("/{alias}", handler)
+	r.Post("/{alias}", handler)
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	guess := func(password string) *http.Response {
+		resp, err := client.PostForm(ts.URL+"/docs", url.Values{"password": {password}})
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	resp, err := client.Get(ts.URL + "/docs")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Contains(t, resp.Header.Get("Content-Type"), "text/html")
+	require.Contains(t, string(body), `<form method="post">`)
+	require.NotContains(t, string(body), "docs.example.com")
+
+	require.Equal(t, http.StatusForbidden, guess("wrong").StatusCode)
+
+	// the password is never posted on to the destination
+	resp = guess("s3cret")
+	require.Equal(t, http.StatusSeeOther, resp.StatusCode)
+	require.Equal(t, "https://docs.example.com/", resp.Header.Get("Location"))
+
+	// a correct password starts the count over
+	for range 3 {
+		require.Equal(t, http.StatusForbidden, guess("wrong").StatusCode)
+	}
+	resp = guess("s3cret")
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	require.NotEmpty(t, resp.Header.Get("Retry-After"))
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+// GetRedirectTest returns the final URL after redirection with the status code.
+func GetRedirectTest(url string, code int) (string, error) {
 	var ErrInvalidStatusCode = errors.New("invalid status code")
 
 	const mark = "GetRedirectTest"
@@ -74,7 +353,7 @@ func GetRedirectTest(url string) (string, error) {
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusFound {
+	if resp.StatusCode != code {
 		return "", fmt.Errorf("%s: %w: %d", mark, ErrInvalidStatusCode, resp.StatusCode)
 	}
 	return resp.Header.Get("Location"), nil
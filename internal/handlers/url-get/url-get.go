@@ -5,21 +5,79 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/FacelessWayfarer/urlshortner/internal/database"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/linklock"
 	"github.com/FacelessWayfarer/urlshortner/internal/lib/response"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/selflink"
 	"github.com/FacelessWayfarer/urlshortner/internal/lib/slogg"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/urlpolicy"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/utm"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/render"
 )
 
 //go:generate go run github.com/vektra/mockery/v2@v2.28.2 --name=URLGetter
 type URLGetter interface {
-	GetURL(alias string) (url string, err error)
+	GetURL(alias string) (database.Link, error)
 }
 
-func New(log *slog.Logger, urlGetter URLGetter) http.HandlerFunc {
+//go:generate go run github.com/vektra/mockery/v2@v2.28.2 --name=VisitCounter
+type VisitCounter interface {
+	UseVisit(alias string) error
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.28.2 --name=ClickRecorder
+type ClickRecorder interface {
+	Record(click database.Click)
+}
+
+// Options tune how links are followed
+type Options struct {
+	// Policy is checked again so links saved before a destination got blocked stop working too
+	Policy *urlpolicy.Policy
+	// SelfLinks follows destinations that are our own short links, only the first alias records a click
+	SelfLinks *selflink.Resolver
+	// RedirectCode is the status of links saved without their own, zero means 302
+	RedirectCode int
+	// MaxAttempts password guesses are allowed per alias within AttemptWindow,
+	// zero values mean linklock.DefaultMaxAttempts and linklock.DefaultWindow
+	MaxAttempts   int
+	AttemptWindow time.Duration
+	// NotYetActive is the answer to links visited before their activation time
+	NotYetActive NotYetActive
+}
+
+// NotYetActive is a status and message, or a redirect to a page like "coming soon" when URL is set
+type NotYetActive struct {
+	Status  int    // zero means 404
+	Message string // empty means "not yet available"
+	URL     string
+}
+
+// maxPasswordForm caps the body of a password guess
+const maxPasswordForm = 4 << 10
+
+// New redirects to the url saved under the alias.
+// Protected links get a password prompt on GET and redirect only after the right password is POSTed.
+// Links with a visit limit take a visit from visitCounter for every redirect and are gone once used up.
+func New(log *slog.Logger, urlGetter URLGetter, visitCounter VisitCounter, clickRecorder ClickRecorder, opts Options) http.HandlerFunc {
+	if opts.RedirectCode == 0 {
+		opts.RedirectCode = http.StatusFound
+	}
+	if opts.NotYetActive.Status == 0 {
+		opts.NotYetActive.Status = http.StatusNotFound
+	}
+	if opts.NotYetActive.Message == "" {
+		opts.NotYetActive.Message = "not yet available"
+	}
+
+	limiter := linklock.NewLimiter(opts.MaxAttempts, opts.AttemptWindow)
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		const mark = "handlers.url-get.New"
 
@@ -33,29 +91,260 @@ func New(log *slog.Logger, urlGetter URLGetter) http.HandlerFunc {
 		if alias == "" {
 			log.Info("alias is empty")
 
-			render.JSON(w, r, response.Error("invalid request"))
+			response.JSON(w, r, response.Error("invalid request"))
 
 			return
 		}
 
-		resURL, err := urlGetter.GetURL(alias)
+		suffix, ok := pathSuffix(r.URL)
+		if !ok {
+			log.Info("invalid path suffix", slog.String("path", r.URL.EscapedPath()))
+
+			response.JSON(w, r, response.NotFound("not found"))
+
+			return
+		}
+
+		link, err := urlGetter.GetURL(alias)
 		if err != nil {
 			if errors.Is(err, database.ErrURLNotFound) {
 				log.Info("url not found", "alias", alias)
 
-				render.JSON(w, r, response.Error("not found"))
+				response.JSON(w, r, response.NotFound("not found"))
 
 				return
 			}
 			log.Error("failed to get url", slogg.Err(err))
 
-			render.JSON(w, r, response.Error("internal error"))
+			response.JSON(w, r, response.Internal("internal error"))
+
+			return
+		}
+
+		if suffix != "" && !link.ForwardPath {
+			log.Info("path suffix on a link that does not forward it", "alias", alias)
+
+			response.JSON(w, r, response.NotFound("not found"))
+
+			return
+		}
+
+		if link.Expired(time.Now()) {
+			log.Info("url expired", "alias", alias)
+
+			response.JSON(w, r, response.Gone("url expired"))
+
+			return
+		}
+
+		if !link.Active(time.Now()) {
+			log.Info("url not active yet", "alias", alias)
+
+			if opts.NotYetActive.URL != "" {
+				http.Redirect(w, r, opts.NotYetActive.URL, http.StatusFound)
+
+				return
+			}
+			if opts.NotYetActive.Status == http.StatusServiceUnavailable {
+				w.Header().Set("Retry-After", link.ActiveFrom.Format(http.TimeFormat))
+			}
+
+			response.JSON(w, r, response.ErrorWithStatus(opts.NotYetActive.Status, opts.NotYetActive.Message))
+
+			return
+		}
+
+		if link.UsedUp() {
+			log.Info("url used up", "alias", alias)
+
+			response.JSON(w, r, response.Gone("url used up"))
+
+			return
+		}
+
+		if link.PasswordHash != "" && !unlock(log, w, r, link, limiter) {
+			return
+		}
+
+		destination, err := opts.SelfLinks.Resolve(alias, link.URL)
+		if err != nil {
+			switch {
+			case errors.Is(err, selflink.ErrCycle), errors.Is(err, selflink.ErrTooDeep):
+				log.Warn("short link loop", slog.String("url", link.URL), slogg.Err(err))
+
+				response.JSON(w, r, response.ErrorWithStatus(http.StatusLoopDetected, "too many short links in a row"))
+			case errors.Is(err, selflink.ErrTargetNotFound):
+				log.Info("short link destination not found", slog.String("url", link.URL), slogg.Err(err))
+
+				response.JSON(w, r, response.NotFound("not found"))
+			default:
+				log.Error("failed to resolve url", slogg.Err(err))
+
+				response.JSON(w, r, response.Internal("internal error"))
+			}
+
+			return
+		}
+
+		if err := opts.Policy.Check(destination); err != nil {
+			log.Warn("url blocked by policy", slog.String("url", destination), slogg.Err(err))
+
+			response.JSON(w, r, response.ErrorWithStatus(http.StatusForbidden, "destination is blocked"))
 
 			return
 		}
 
-		log.Info("retrived url", slog.String("url", resURL))
+		// stored parameters go first so the query of the visit can not override them
+		destination, err = utm.Apply(destination, link.Params, utm.Vars{Alias: link.Alias, Now: time.Now()})
+		if err != nil {
+			log.Error("failed to add params to url", slog.String("url", link.URL), slogg.Err(err))
+
+			response.JSON(w, r, response.Internal("internal error"))
+
+			return
+		}
+
+		destination, err = Forward(destination, suffix, r.URL.RawQuery, link)
+		if err != nil {
+			log.Error("failed to forward request to url", slog.String("url", link.URL), slogg.Err(err))
+
+			response.JSON(w, r, response.Internal("internal error"))
 
-		http.Redirect(w, r, resURL, http.StatusFound)
+			return
+		}
+
+		// taken last so visits refused for any other reason are not used up
+		if link.VisitsLeft != nil {
+			if err := visitCounter.UseVisit(link.Alias); err != nil {
+				if errors.Is(err, database.ErrNoVisitsLeft) {
+					log.Info("url used up", "alias", alias)
+
+					response.JSON(w, r, response.Gone("url used up"))
+
+					return
+				}
+				log.Error("failed to use a visit", slogg.Err(err))
+
+				response.JSON(w, r, response.Internal("internal error"))
+
+				return
+			}
+		}
+
+		log.Info("retrived url", slog.String("url", destination))
+
+		clickRecorder.Record(database.Click{
+			Alias:     link.Alias, // the stored spelling, the requested one may differ in case
+			ClickedAt: time.Now(),
+			Referrer:  r.Referer(),
+			UserAgent: r.UserAgent(),
+			RequestID: middleware.GetReqID(r.Context()),
+		})
+
+		code := link.RedirectCode
+		if code == 0 {
+			code = opts.RedirectCode
+		}
+		if r.Method == http.MethodPost {
+			// the browser must follow with a GET, 307 and 308 would post the password to the destination
+			code = http.StatusSeeOther
+		}
+
+		http.Redirect(w, r, destination, code)
 	}
 }
+
+// unlock reports whether the request gave the password of a protected link,
+// otherwise it has written the prompt
+func unlock(log *slog.Logger, w http.ResponseWriter, r *http.Request, link database.Link, limiter *linklock.Limiter) bool {
+	if r.Method != http.MethodPost {
+		writePrompt(w, http.StatusOK, "")
+
+		return false
+	}
+
+	retryAfter, ok := limiter.Attempt(link.Alias, time.Now())
+	if !ok {
+		log.Warn("too many password attempts", slog.String("alias", link.Alias))
+
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Round(time.Second)/time.Second)))
+		writePrompt(w, http.StatusTooManyRequests, "Too many attempts, try again later.")
+
+		return false
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxPasswordForm)
+	if !linklock.Verify(link.PasswordHash, r.PostFormValue("password")) {
+		log.Info("wrong password", slog.String("alias", link.Alias))
+
+		writePrompt(w, http.StatusForbidden, "Wrong password.")
+
+		return false
+	}
+
+	limiter.Succeed(link.Alias)
+
+	return true
+}
+
+// pathSuffix returns the escaped path that follows the alias, without the leading slash.
+// Dot segments are refused so a suffix can not climb above the destination path.
+func pathSuffix(u *url.URL) (string, bool) {
+	_, suffix, _ := strings.Cut(strings.TrimPrefix(u.EscapedPath(), "/"), "/")
+
+	for _, segment := range strings.Split(suffix, "/") {
+		segment, err := url.PathUnescape(segment)
+		if err != nil || segment == "." || segment == ".." {
+			return "", false
+		}
+	}
+
+	return suffix, true
+}
+
+// Forward passes what the visit added to the short link on to the destination: the path suffix
+// is appended when the link forwards paths, and query parameters are added when it forwards queries.
+// Parameters the destination already has keep their stored values, the rest follow in the order they came.
+func Forward(destination, suffix, rawQuery string, link database.Link) (string, error) {
+	forwardPath := link.ForwardPath && suffix != ""
+	forwardQuery := link.ForwardQuery && rawQuery != ""
+	if !forwardPath && !forwardQuery {
+		return destination, nil
+	}
+
+	u, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+
+	if forwardPath {
+		rawPath := strings.TrimSuffix(u.EscapedPath(), "/") + "/" + suffix
+		path, err := url.PathUnescape(rawPath)
+		if err != nil {
+			return "", err
+		}
+		u.Path, u.RawPath = path, rawPath
+	}
+
+	if forwardQuery {
+		stored := u.Query()
+		pairs := make([]string, 0, strings.Count(rawQuery, "&")+2)
+		if u.RawQuery != "" {
+			pairs = append(pairs, u.RawQuery)
+		}
+
+		for _, pair := range strings.Split(rawQuery, "&") {
+			key, _, _ := strings.Cut(pair, "=")
+			key, err := url.QueryUnescape(key)
+			if err != nil || key == "" {
+				continue
+			}
+			if _, ok := stored[key]; !ok {
+				pairs = append(pairs, pair)
+			}
+		}
+		u.RawQuery = strings.Join(pairs, "&")
+	}
+
+	return u.String(), nil
+}
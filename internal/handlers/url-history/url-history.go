@@ -0,0 +1,77 @@
+package urlhistory
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/database"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/response"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/slogg"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type Response struct {
+	response.Response
+	Alias   string  `json:"alias,omitempty"`
+	History []Entry `json:"history"`
+}
+
+type Entry struct {
+	URL        string    `json:"url"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+type HistoryGetter interface {
+	GetHistory(alias string) ([]database.HistoryEntry, error)
+}
+
+// New serves GET /url/{alias}/history, previous targets newest first
+func New(log *slog.Logger, historyGetter HistoryGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const mark = "handlers.url-history.New"
+
+		log := log.With(
+			slog.String("mark", mark),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		alias := chi.URLParam(r, "alias")
+		if alias == "" {
+			log.Info("alias is empty")
+
+			response.JSON(w, r, response.Error("invalid request"))
+
+			return
+		}
+
+		history, err := historyGetter.GetHistory(alias)
+		if err != nil {
+			if errors.Is(err, database.ErrURLNotFound) {
+				log.Info("url not found", "alias", alias)
+
+				response.JSON(w, r, response.NotFound("not found"))
+
+				return
+			}
+			log.Error("failed to get history", slogg.Err(err))
+
+			response.JSON(w, r, response.Internal("internal error"))
+
+			return
+		}
+
+		resp := Response{
+			Response: response.OK(),
+			Alias:    alias,
+			History:  make([]Entry, 0, len(history)),
+		}
+		for _, h := range history {
+			resp.History = append(resp.History, Entry{URL: h.URL, ReplacedAt: h.ReplacedAt})
+		}
+
+		response.JSON(w, r, resp)
+	}
+}
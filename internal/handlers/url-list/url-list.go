@@ -0,0 +1,169 @@
+package urllist
+
+import (
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/database"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/response"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/slogg"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type Response struct {
+	response.Response
+	Links      []Link `json:"links"`
+	NextCursor string `json:"next_cursor,omitempty"` // empty on the last page
+}
+
+type Link struct {
+	Alias        string            `json:"alias"`
+	URL          string            `json:"url"`
+	CreatedAt    *time.Time        `json:"created_at,omitempty"`
+	ExpiresAt    *time.Time        `json:"expires_at,omitempty"`
+	ActiveFrom   *time.Time        `json:"active_from,omitempty"`
+	Redirect     int               `json:"redirect,omitempty"` // empty for links redirecting with the server default
+	ForwardQuery bool              `json:"forward_query,omitempty"`
+	ForwardPath  bool              `json:"forward_path,omitempty"`
+	Params       map[string]string `json:"params,omitempty"`
+	Protected    bool              `json:"protected,omitempty"`   // the link asks for a password
+	VisitsLeft   *int              `json:"visits_left,omitempty"` // empty for links without a limit
+}
+
+type URLLister interface {
+	ListURLs(filter database.ListFilter) ([]database.Link, error)
+}
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// New serves GET /url?limit=&cursor=&order=asc|desc&alias_prefix=&url_contains=,
+// links are sorted by creation time, newest first by default
+func New(log *slog.Logger, urlLister URLLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const mark = "handlers.url-list.New"
+
+		log := log.With(
+			slog.String("mark", mark),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		query := r.URL.Query()
+
+		filter := database.ListFilter{
+			AliasPrefix: query.Get("alias_prefix"),
+			URLContains: query.Get("url_contains"),
+			Desc:        true,
+			Limit:       defaultLimit,
+		}
+
+		switch query.Get("order") {
+		case "", "desc":
+		case "asc":
+			filter.Desc = false
+		default:
+			log.Info("invalid order", slog.String("order", query.Get("order")))
+
+			response.JSON(w, r, response.Error("order must be asc or desc"))
+
+			return
+		}
+
+		if l := query.Get("limit"); l != "" {
+			limit, err := strconv.Atoi(l)
+			if err != nil || limit < 1 || limit > maxLimit {
+				log.Info("invalid limit", slog.String("limit", l))
+
+				response.JSON(w, r, response.Error("limit must be between 1 and "+strconv.Itoa(maxLimit)))
+
+				return
+			}
+			filter.Limit = limit
+		}
+
+		if c := query.Get("cursor"); c != "" {
+			cursor, err := DecodeCursor(c)
+			if err != nil {
+				log.Info("invalid cursor", slog.String("cursor", c))
+
+				response.JSON(w, r, response.Error(err.Error()))
+
+				return
+			}
+			filter.Cursor = cursor
+		}
+
+		// one extra link tells whether there is a next page
+		filter.Limit++
+		links, err := urlLister.ListURLs(filter)
+		if err != nil {
+			log.Error("failed to list urls", slogg.Err(err))
+
+			response.JSON(w, r, response.Internal("internal error"))
+
+			return
+		}
+		filter.Limit--
+
+		resp := Response{
+			Response: response.OK(),
+			Links:    make([]Link, 0, len(links)),
+		}
+
+		if len(links) > filter.Limit {
+			links = links[:filter.Limit]
+			resp.NextCursor = EncodeCursor(links[len(links)-1].ID)
+		}
+
+		for _, link := range links {
+			l := Link{
+				Alias:        link.Alias,
+				URL:          link.URL,
+				ExpiresAt:    link.ExpiresAt,
+				ActiveFrom:   link.ActiveFrom,
+				Redirect:     link.RedirectCode,
+				ForwardQuery: link.ForwardQuery,
+				ForwardPath:  link.ForwardPath,
+				Params:       link.Params,
+				Protected:    link.PasswordHash != "",
+				VisitsLeft:   link.VisitsLeft,
+			}
+			if !link.CreatedAt.IsZero() {
+				createdAt := link.CreatedAt
+				l.CreatedAt = &createdAt
+			}
+			resp.Links = append(resp.Links, l)
+		}
+
+		log.Info("listed urls", slog.Int("count", len(resp.Links)))
+
+		response.JSON(w, r, resp)
+	}
+}
+
+// EncodeCursor hides the id behind an opaque token so clients do not build cursors themselves
+func EncodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func DecodeCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, ErrInvalidCursor
+	}
+
+	return id, nil
+}
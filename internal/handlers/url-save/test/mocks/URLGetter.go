@@ -2,7 +2,10 @@
 
 package mocks
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	database "github.com/FacelessWayfarer/urlshortner/internal/database"
+	mock "github.com/stretchr/testify/mock"
+)
 
 // URLGetter is an autogenerated mock type for the URLGetter type
 type URLGetter struct {
@@ -10,18 +13,18 @@ type URLGetter struct {
 }
 
 // GetURL provides a mock function with given fields: alias
-func (_m *URLGetter) GetURL(alias string) (string, error) {
+func (_m *URLGetter) GetURL(alias string) (database.Link, error) {
 	ret := _m.Called(alias)
 
-	var r0 string
+	var r0 database.Link
 	var r1 error
-	if rf, ok := ret.Get(0).(func(string) (string, error)); ok {
+	if rf, ok := ret.Get(0).(func(string) (database.Link, error)); ok {
 		return rf(alias)
 	}
-	if rf, ok := ret.Get(0).(func(string) string); ok {
+	if rf, ok := ret.Get(0).(func(string) database.Link); ok {
 		r0 = rf(alias)
 	} else {
-		r0 = ret.Get(0).(string)
+		r0 = ret.Get(0).(database.Link)
 	}
 
 	if rf, ok := ret.Get(1).(func(string) error); ok {
@@ -2,30 +2,88 @@
 
 package mocks
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	database "github.com/FacelessWayfarer/urlshortner/internal/database"
+	mock "github.com/stretchr/testify/mock"
+)
 
 // URLSaver is an autogenerated mock type for the URLSaver type
 type URLSaver struct {
 	mock.Mock
 }
 
-// SaveURL provides a mock function with given fields: urlToSave, alias
-func (_m *URLSaver) SaveURL(urlToSave string, alias string) (int64, error) {
-	ret := _m.Called(urlToSave, alias)
+// FindOrSaveGeneratedURL provides a mock function with given fields: link, newAlias
+func (_m *URLSaver) FindOrSaveGeneratedURL(link database.Link, newAlias database.AliasFunc) (database.Link, bool, error) {
+	ret := _m.Called(link, newAlias)
+
+	var r0 database.Link
+	var r1 bool
+	var r2 error
+	if rf, ok := ret.Get(0).(func(database.Link, database.AliasFunc) (database.Link, bool, error)); ok {
+		return rf(link, newAlias)
+	}
+	if rf, ok := ret.Get(0).(func(database.Link, database.AliasFunc) database.Link); ok {
+		r0 = rf(link, newAlias)
+	} else {
+		r0 = ret.Get(0).(database.Link)
+	}
+
+	if rf, ok := ret.Get(1).(func(database.Link, database.AliasFunc) bool); ok {
+		r1 = rf(link, newAlias)
+	} else {
+		r1 = ret.Get(1).(bool)
+	}
+
+	if rf, ok := ret.Get(2).(func(database.Link, database.AliasFunc) error); ok {
+		r2 = rf(link, newAlias)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// SaveGeneratedURL provides a mock function with given fields: link, newAlias
+func (_m *URLSaver) SaveGeneratedURL(link database.Link, newAlias database.AliasFunc) (database.Link, error) {
+	ret := _m.Called(link, newAlias)
+
+	var r0 database.Link
+	var r1 error
+	if rf, ok := ret.Get(0).(func(database.Link, database.AliasFunc) (database.Link, error)); ok {
+		return rf(link, newAlias)
+	}
+	if rf, ok := ret.Get(0).(func(database.Link, database.AliasFunc) database.Link); ok {
+		r0 = rf(link, newAlias)
+	} else {
+		r0 = ret.Get(0).(database.Link)
+	}
+
+	if rf, ok := ret.Get(1).(func(database.Link, database.AliasFunc) error); ok {
+		r1 = rf(link, newAlias)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SaveURL provides a mock function with given fields: link
+func (_m *URLSaver) SaveURL(link database.Link) (int64, error) {
+	ret := _m.Called(link)
 
 	var r0 int64
 	var r1 error
-	if rf, ok := ret.Get(0).(func(string, string) (int64, error)); ok {
-		return rf(urlToSave, alias)
+	if rf, ok := ret.Get(0).(func(database.Link) (int64, error)); ok {
+		return rf(link)
 	}
-	if rf, ok := ret.Get(0).(func(string, string) int64); ok {
-		r0 = rf(urlToSave, alias)
+	if rf, ok := ret.Get(0).(func(database.Link) int64); ok {
+		r0 = rf(link)
 	} else {
 		r0 = ret.Get(0).(int64)
 	}
 
-	if rf, ok := ret.Get(1).(func(string, string) error); ok {
-		r1 = rf(urlToSave, alias)
+	if rf, ok := ret.Get(1).(func(database.Link) error); ok {
+		r1 = rf(link)
 	} else {
 		r1 = ret.Error(1)
 	}
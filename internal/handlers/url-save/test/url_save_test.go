@@ -4,64 +4,151 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
-	"fmt"
-	"io"
-	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/FacelessWayfarer/urlshortner/internal/alias"
 	"github.com/FacelessWayfarer/urlshortner/internal/database"
 	urlsave "github.com/FacelessWayfarer/urlshortner/internal/handlers/url-save"
 	"github.com/FacelessWayfarer/urlshortner/internal/handlers/url-save/test/mocks"
 	discardslogg "github.com/FacelessWayfarer/urlshortner/internal/lib/discard-slogg"
-	"github.com/FacelessWayfarer/urlshortner/internal/lib/random"
-	"github.com/FacelessWayfarer/urlshortner/internal/lib/response"
-	"github.com/FacelessWayfarer/urlshortner/internal/lib/slogg"
-	"github.com/go-chi/chi/middleware"
-	"github.com/go-chi/render"
-	"github.com/go-playground/validator/v10"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
 func TestSaveHandle(t *testing.T) {
+	future := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	past := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+
 	cases := []struct {
 		name      string
 		alias     string
 		url       string
-		respError string
-		mockError error
+		ttl       string
+		expiresAt *time.Time
+		// activeFrom and activeUntil set the activation window of the link
+		activeFrom  *time.Time
+		activeUntil *time.Time
+		respError   string
+		respCode    int // expected HTTP status, 0 for 200
+		mockError   error
+		expiry      time.Duration // expected lifetime of the saved link, 0 for links that never expire
 	}{
 		{
 			name:  "Success",
 			alias: "test_alias",
-			url:   "https://google.com",
+			url:   "https://google.com/",
 		},
 		{
 			name:  "Empty alias",
 			alias: "",
-			url:   "https://google.com",
+			url:   "https://google.com/",
 		},
 		{
 			name:      "Empty URL",
 			url:       "",
 			alias:     "some_alias",
 			respError: "field URL is a required field",
+			respCode:  http.StatusBadRequest,
 		},
 		{
 			name:      "Invalid URL",
 			url:       "some invalid URL",
 			alias:     "some_alias",
 			respError: "field URL is not a valid URL",
+			respCode:  http.StatusBadRequest,
 		},
 		{
 			name:      "SaveURL Error",
 			alias:     "test_alias",
-			url:       "https://google.com",
+			url:       "https://google.com/",
 			respError: "failed to add url",
+			respCode:  http.StatusInternalServerError,
 			mockError: errors.New("unexpected error"),
 		},
+		{
+			name:      "Already exists",
+			alias:     "test_alias",
+			url:       "https://google.com/",
+			respError: "url already exists",
+			respCode:  http.StatusConflict,
+			mockError: database.ErrURLAlreadyExists,
+		},
+		{
+			name:   "TTL",
+			alias:  "test_alias",
+			url:    "https://google.com/",
+			ttl:    "24h",
+			expiry: 24 * time.Hour,
+		},
+		{
+			name:      "Expires at",
+			alias:     "test_alias",
+			url:       "https://google.com/",
+			expiresAt: &future,
+			expiry:    time.Hour,
+		},
+		{
+			name:      "Expires at in the past",
+			alias:     "test_alias",
+			url:       "https://google.com/",
+			expiresAt: &past,
+			respError: urlsave.ErrExpiryInPast.Error(),
+			respCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Invalid TTL",
+			alias:     "test_alias",
+			url:       "https://google.com/",
+			ttl:       "forever",
+			respError: urlsave.ErrInvalidTTL.Error(),
+			respCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Negative TTL",
+			alias:     "test_alias",
+			url:       "https://google.com/",
+			ttl:       "-1h",
+			respError: urlsave.ErrInvalidTTL.Error(),
+			respCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "TTL and expires at",
+			alias:     "test_alias",
+			url:       "https://google.com/",
+			ttl:       "1h",
+			expiresAt: &future,
+			respError: urlsave.ErrExpiryConflict.Error(),
+			respCode:  http.StatusBadRequest,
+		},
+		{
+			name:        "Active until and expires at",
+			alias:       "test_alias",
+			url:         "https://google.com/",
+			expiresAt:   &future,
+			activeUntil: &future,
+			respError:   urlsave.ErrExpiryConflict.Error(),
+			respCode:    http.StatusBadRequest,
+		},
+		{
+			name:        "Empty activation window",
+			alias:       "test_alias",
+			url:         "https://google.com/",
+			activeFrom:  &future,
+			activeUntil: &future,
+			respError:   urlsave.ErrEmptyWindow.Error(),
+			respCode:    http.StatusBadRequest,
+		},
+		{
+			name:        "Activation window",
+			alias:       "test_alias",
+			url:         "https://google.com/",
+			activeFrom:  &past,
+			activeUntil: &future,
+			expiry:      time.Hour,
+		},
 	}
 
 	for _, tc := range cases {
@@ -72,23 +159,56 @@ func TestSaveHandle(t *testing.T) {
 			urlSaverMock := mocks.NewURLSaver(t)
 
 			if tc.respError == "" || tc.mockError != nil {
-				urlSaverMock.On("SaveURL", tc.url, mock.AnythingOfType("string")).
-					Return(int64(1), tc.mockError).
-					Once()
-
+				matchLink := mock.MatchedBy(func(link database.Link) bool {
+					if link.URL != tc.url {
+						return false
+					}
+					if tc.expiry == 0 {
+						return link.ExpiresAt == nil
+					}
+					return link.ExpiresAt != nil &&
+						time.Until(*link.ExpiresAt) > tc.expiry-time.Minute &&
+						time.Until(*link.ExpiresAt) <= tc.expiry
+				})
+
+				if tc.alias == "" {
+					urlSaverMock.On("SaveGeneratedURL", matchLink, mock.AnythingOfType("database.AliasFunc")).
+						Return(func(link database.Link, newAlias database.AliasFunc) (database.Link, error) {
+							link.ID = 1
+							link.Alias, _ = newAlias(link.ID, 0)
+							return link, tc.mockError
+						}).
+						Once()
+				} else {
+					urlSaverMock.On("SaveURL", matchLink).
+						Return(int64(1), tc.mockError).
+						Once()
+				}
 			}
 
-			handler := NewMock(discardslogg.NewDiscardLogger(), urlSaverMock)
+			handler := urlsave.New(discardslogg.NewDiscardLogger(), urlSaverMock, alias.Sequential{}, urlsave.Options{})
 
-			input := fmt.Sprintf(`{"url": "%s", "alias": "%s"}`, tc.url, tc.alias)
+			input, err := json.Marshal(urlsave.Request{
+				URL:         tc.url,
+				Alias:       tc.alias,
+				TTL:         tc.ttl,
+				ExpiresAt:   tc.expiresAt,
+				ActiveFrom:  tc.activeFrom,
+				ActiveUntil: tc.activeUntil,
+			})
+			require.NoError(t, err)
 
-			req, err := http.NewRequest(http.MethodPost, "/save", bytes.NewReader([]byte(input)))
+			req, err := http.NewRequest(http.MethodPost, "/save", bytes.NewReader(input))
 			require.NoError(t, err)
 
 			rr := httptest.NewRecorder()
 			handler.ServeHTTP(rr, req)
 
-			require.Equal(t, rr.Code, http.StatusOK)
+			respCode := tc.respCode
+			if respCode == 0 {
+				respCode = http.StatusOK
+			}
+			require.Equal(t, respCode, rr.Code)
 
 			body := rr.Body.String()
 
@@ -98,89 +218,83 @@ func TestSaveHandle(t *testing.T) {
 
 			require.Equal(t, tc.respError, resp.Error)
 
-			// TODO: add more checks
+			if tc.respError == "" {
+				require.NotEmpty(t, resp.Alias)
+				require.Equal(t, tc.expiry != 0, resp.ExpiresAt != nil)
+			}
 		})
 	}
 }
 
-// NewMock() almost equal to urlsave.New() with the exeption of disabled check for random generated alias been equal to an alias already existing in the database
-func NewMock(log *slog.Logger, urlSaver urlsave.URLSaver) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		const mark = "handlers.url-save.New"
-
-		log := log.With(
-			slog.String("mark", mark),
-			slog.String("request_id", middleware.GetReqID(r.Context())),
-		)
-
-		var req urlsave.Request
-
-		if err := render.DecodeJSON(r.Body, &req); err != nil {
-			if errors.Is(err, io.EOF) {
-				log.Error("request body is empty")
+func TestSaveHandle_AliasExhausted(t *testing.T) {
+	urlSaverMock := mocks.NewURLSaver(t)
 
-				render.JSON(w, r, response.Error("empty request"))
+	urlSaverMock.On("SaveGeneratedURL", mock.Anything, mock.Anything).
+		Return(database.Link{}, database.ErrAliasExhausted).
+		Once()
 
-				return
-			}
-			err = render.DefaultDecoder(r, &req)
-			if err != nil {
-				log.Error("failed to deecode request body")
-
-				render.JSON(w, r, response.Error("failed to decode request"))
-
-				return
-			}
-			log.Info("request body decoded; format:unknown", slog.Any("request", req))
-		}
+	handler := urlsave.New(discardslogg.NewDiscardLogger(), urlSaverMock, alias.Sequential{}, urlsave.Options{})
 
-		log.Info("request body decoded; format:JSON", slog.Any("request", req))
+	req, err := http.NewRequest(http.MethodPost, "/save", bytes.NewReader([]byte(`{"url":"https://google.com"}`)))
+	require.NoError(t, err)
 
-		if err := validator.New().Struct(req); err != nil {
-			validateErr := err.(validator.ValidationErrors)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
 
-			log.Error("invalid request", slogg.Err(err))
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
 
-			render.JSON(w, r, response.ValidationError(validateErr))
+	var resp urlsave.Response
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	require.Equal(t, "failed to generate a free alias, try again or set one", resp.Error)
+}
 
-			return
-		}
+func TestSaveHandle_Dedup(t *testing.T) {
+	cases := []struct {
+		name     string
+		force    bool
+		existing bool
+	}{
+		{name: "Reused", existing: true},
+		{name: "Saved"},
+		{name: "Force", force: true},
+	}
 
-		const aliasLength = 5
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			urlSaverMock := mocks.NewURLSaver(t)
 
-		alias := req.Alias
-		if alias == "" {
-			// for i := 0; i < retrycount; i++ {
-			alias = random.NewRandomString(aliasLength)
-			// 	_, err := urlGetter.GetURL(alias)
-			// 	if errors.Is(err, database.ErrURLNotFound) {
-			// 		break
-			// 	}
-			// }
-		}
+			normalized := mock.MatchedBy(func(link database.Link) bool {
+				return link.URL == "https://google.com/"
+			})
+			saved := database.Link{ID: 7, Alias: "7", URL: "https://google.com/", Generated: true}
 
-		id, err := urlSaver.SaveURL(req.URL, alias)
-		if err != nil {
-			if errors.Is(err, database.ErrURLAlreadyExists) {
-				log.Info("url already exists", slog.String("url", req.URL))
+			if tc.force {
+				urlSaverMock.On("SaveGeneratedURL", normalized, mock.Anything).
+					Return(saved, nil).
+					Once()
+			} else {
+				urlSaverMock.On("FindOrSaveGeneratedURL", normalized, mock.Anything).
+					Return(saved, tc.existing, nil).
+					Once()
+			}
 
-				render.JSON(w, r, response.Error("url already exists"))
+			handler := urlsave.New(discardslogg.NewDiscardLogger(), urlSaverMock, alias.Sequential{}, urlsave.Options{Dedup: true})
 
-				return
-			}
-			log.Error("failed to add url", slogg.Err(err))
+			input, err := json.Marshal(urlsave.Request{URL: "HTTPS://Google.COM:443", Force: tc.force})
+			require.NoError(t, err)
 
-			render.JSON(w, r, response.Error("failed to add url"))
+			req, err := http.NewRequest(http.MethodPost, "/save", bytes.NewReader(input))
+			require.NoError(t, err)
 
-			return
-		}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
 
-		log.Info("url added", slog.Int64("id", id))
+			require.Equal(t, http.StatusOK, rr.Code)
 
-		render.JSON(w, r, urlsave.Response{
-			Response: response.OK(),
-			Alias:    alias,
+			var resp urlsave.Response
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			require.Equal(t, "7", resp.Alias)
+			require.Equal(t, tc.existing, resp.Existing)
 		})
-
 	}
 }
@@ -2,42 +2,144 @@ package urlsave
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"time"
 
+	"github.com/FacelessWayfarer/urlshortner/internal/alias"
 	"github.com/FacelessWayfarer/urlshortner/internal/database"
-	urlget "github.com/FacelessWayfarer/urlshortner/internal/handlers/url-get"
-	"github.com/FacelessWayfarer/urlshortner/internal/lib/random"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/linklock"
 	"github.com/FacelessWayfarer/urlshortner/internal/lib/response"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/selflink"
 	"github.com/FacelessWayfarer/urlshortner/internal/lib/slogg"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/urlnorm"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/urlpolicy"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/utm"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	"github.com/go-playground/validator/v10"
 )
 
 type Request struct {
-	URL   string `json:"url" validate:"required,url"`
-	Alias string `json:"alias,omitempty"`
+	URL       string     `json:"url" validate:"required,url"`
+	Alias     string     `json:"alias,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // RFC 3339 moment the link stops working
+	TTL       string     `json:"ttl,omitempty"`        // lifetime of the link as a Go duration, e.g. "72h"
+	// ActiveFrom is the RFC 3339 moment the link starts redirecting, ActiveUntil is another name for ExpiresAt
+	ActiveFrom  *time.Time `json:"active_from,omitempty"`
+	ActiveUntil *time.Time `json:"active_until,omitempty"`
+	Force       bool       `json:"force,omitempty"` // generate a fresh alias even when deduplication would reuse one
+	// Redirect is the HTTP status the link redirects with, the server default when empty
+	Redirect int `json:"redirect,omitempty" validate:"omitempty,oneof=301 302 303 307 308"`
+	// ForwardQuery merges the query string of the visit into the destination
+	ForwardQuery bool `json:"forward_query,omitempty"`
+	// ForwardPath appends what follows the alias in the visited path to the destination
+	ForwardPath bool `json:"forward_path,omitempty"`
+	// Params are query parameters added to the destination on redirect, values may use {alias} and {date}
+	Params map[string]string `json:"params,omitempty"`
+	// Password gates the link behind a prompt, only its hash is stored
+	Password string `json:"password,omitempty"`
+	// MaxVisits is how many redirects the link serves before it is gone, 1 for a link that works once
+	MaxVisits int `json:"max_visits,omitempty" validate:"omitempty,min=1"`
+}
+
+// LogValue keeps the password out of the logs
+func (r Request) LogValue() slog.Value {
+	if r.Password != "" {
+		r.Password = "[hidden]"
+	}
+
+	type plain Request // without the method, so it is not called again
+
+	return slog.AnyValue(plain(r))
 }
 
 type Response struct {
 	response.Response
-	Alias string `json:"alias,omitempty"`
+	Alias        string            `json:"alias,omitempty"`
+	URL          string            `json:"url,omitempty"` // canonical form of the requested url, this is what gets stored
+	ExpiresAt    *time.Time        `json:"expires_at,omitempty"`
+	ActiveFrom   *time.Time        `json:"active_from,omitempty"`
+	Existing     bool              `json:"existing,omitempty"` // the alias was generated for the same url before
+	Redirect     int               `json:"redirect,omitempty"`
+	ForwardQuery bool              `json:"forward_query,omitempty"`
+	ForwardPath  bool              `json:"forward_path,omitempty"`
+	Params       map[string]string `json:"params,omitempty"`
+	Protected    bool              `json:"protected,omitempty"` // the link asks for a password
+	VisitsLeft   *int              `json:"visits_left,omitempty"`
+}
+
+// Options tune how links are saved
+type Options struct {
+	// Dedup reuses the generated alias of a url saved before instead of generating another one
+	Dedup bool
+	// Normalize tunes the canonical form urls are stored in
+	Normalize urlnorm.Options
+	// Policy rejects destinations links may not point to, nil allows every url
+	Policy *urlpolicy.Policy
+	// SelfLinks flattens destinations that are our own short links, nil keeps them as they are
+	SelfLinks *selflink.Resolver
+	// Aliases are the rules for aliases chosen by the client, nil allows any
+	Aliases *alias.Rules
+}
+
+// DestinationError is a url that can not be saved, Tag names the check it failed
+type DestinationError struct {
+	Tag string
+	Err error
+}
+
+func (e *DestinationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DestinationError) Unwrap() error {
+	return e.Err
 }
 
+// Response is the client error to send, it is a 400 for the URL field
+func (e *DestinationError) Response() response.Response {
+	return response.InvalidField("URL", e.Tag, e.Error())
+}
+
+// RequestError is a request the client has to fix
+type RequestError struct {
+	Err  error
+	resp response.Response
+}
+
+func (e *RequestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// Response is the client error to send
+func (e *RequestError) Response() response.Response {
+	return e.resp
+}
+
+var (
+	ErrExpiryConflict = errors.New("expires_at, active_until and ttl are mutually exclusive")
+	ErrInvalidTTL     = errors.New("ttl must be a positive duration like 24h")
+	ErrExpiryInPast   = errors.New("expires_at must be in the future")
+	ErrEmptyWindow    = errors.New("active_from must be before the link expires")
+)
+
 // interface of the database decleared where it is used
 
 //go:generate go run github.com/vektra/mockery/v2@v2.28.2 --name=URLSaver
 type URLSaver interface {
-	SaveURL(longURL, alias string) (int64, error)
+	SaveURL(link database.Link) (int64, error)
+	SaveGeneratedURL(link database.Link, newAlias database.AliasFunc) (database.Link, error)
+	FindOrSaveGeneratedURL(link database.Link, newAlias database.AliasFunc) (database.Link, bool, error)
 }
 
-const (
-	retrycount = 5 // number of trys to generate psudo-random alias without collision
-)
-
-func New(log *slog.Logger, urlSaver URLSaver, urlGetter urlget.URLGetter) http.HandlerFunc {
+func New(log *slog.Logger, urlSaver URLSaver, aliasGen alias.Generator, opts Options) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const mark = "handlers.url-save.New"
 
@@ -52,7 +154,7 @@ func New(log *slog.Logger, urlSaver URLSaver, urlGetter urlget.URLGetter) http.H
 			if errors.Is(err, io.EOF) {
 				log.Error("request body is empty")
 
-				render.JSON(w, r, response.Error("empty request"))
+				response.JSON(w, r, response.Error("empty request"))
 
 				return
 			}
@@ -60,7 +162,7 @@ func New(log *slog.Logger, urlSaver URLSaver, urlGetter urlget.URLGetter) http.H
 			if err != nil {
 				log.Error("failed to deecode request body")
 
-				render.JSON(w, r, response.Error("failed to decode request"))
+				response.JSON(w, r, response.Error("failed to decode request"))
 
 				return
 			}
@@ -69,51 +171,244 @@ func New(log *slog.Logger, urlSaver URLSaver, urlGetter urlget.URLGetter) http.H
 
 		log.Info("request body decoded; format:JSON", slog.Any("request", req))
 
-		if err := validator.New().Struct(req); err != nil {
-			validateErr := err.(validator.ValidationErrors)
+		link, err := Build(req, time.Now(), opts)
+		if err != nil {
+			var reqErr *RequestError
+			if errors.As(err, &reqErr) {
+				log.Info("invalid request", slogg.Err(err))
 
-			log.Error("invalid request", slogg.Err(err))
+				response.JSON(w, r, reqErr.Response())
 
-			render.JSON(w, r, response.ValidationError(validateErr))
+				return
+			}
+			log.Error("failed to build link", slogg.Err(err))
+
+			response.JSON(w, r, response.Internal("failed to add url"))
 
 			return
 		}
 
-		const aliasLength = 5
+		var existing bool
 
-		alias := req.Alias
-		if alias == "" {
-			for i := 0; i < retrycount; i++ {
-				alias = random.NewRandomString(aliasLength)
-				_, err := urlGetter.GetURL(alias)
-				if errors.Is(err, database.ErrURLNotFound) {
-					break
-				}
-			}
+		switch {
+		case link.Alias != "":
+			link.ID, err = urlSaver.SaveURL(link)
+		case opts.Dedup && !req.Force:
+			link, existing, err = urlSaver.FindOrSaveGeneratedURL(link, GenerateAlias(aliasGen, opts.Aliases))
+		default:
+			link, err = urlSaver.SaveGeneratedURL(link, GenerateAlias(aliasGen, opts.Aliases))
 		}
-
-		id, err := urlSaver.SaveURL(req.URL, alias)
 		if err != nil {
 			if errors.Is(err, database.ErrURLAlreadyExists) {
 				log.Info("url already exists", slog.String("url", req.URL))
 
-				render.JSON(w, r, response.Error("url already exists"))
+				response.JSON(w, r, response.Conflict("url already exists"))
+
+				return
+			}
+			if errors.Is(err, database.ErrAliasExhausted) {
+				log.Error("no free alias generated", slogg.Err(err))
+
+				response.JSON(w, r, response.ErrorWithStatus(http.StatusServiceUnavailable, "failed to generate a free alias, try again or set one"))
 
 				return
 			}
 			log.Error("failed to add url", slogg.Err(err))
 
-			render.JSON(w, r, response.Error("failed to add url"))
+			response.JSON(w, r, response.Internal("failed to add url"))
 
 			return
 		}
 
-		log.Info("url added", slog.Int64("id", id))
+		if existing {
+			log.Info("url reused", slog.Int64("id", link.ID))
+		} else {
+			log.Info("url added", slog.Int64("id", link.ID))
+		}
 
-		render.JSON(w, r, Response{
-			Response: response.OK(),
-			Alias:    alias,
+		response.JSON(w, r, Response{
+			Response:     response.OK(),
+			Alias:        link.Alias,
+			URL:          link.URL,
+			ExpiresAt:    link.ExpiresAt,
+			ActiveFrom:   link.ActiveFrom,
+			Existing:     existing,
+			Redirect:     link.RedirectCode,
+			ForwardQuery: link.ForwardQuery,
+			ForwardPath:  link.ForwardPath,
+			Params:       link.Params,
+			Protected:    link.PasswordHash != "",
+			VisitsLeft:   link.VisitsLeft,
 		})
 
 	}
 }
+
+// Build checks a request and turns it into the link to save, the alias stays empty when
+// it is to be generated. Requests the client has to fix fail with a *RequestError,
+// other errors are internal.
+func Build(req Request, now time.Time, opts Options) (database.Link, error) {
+	const mark = "handlers.url-save.Build"
+
+	if err := validator.New().Struct(req); err != nil {
+		return database.Link{}, &RequestError{
+			Err:  err,
+			resp: response.ValidationError(err.(validator.ValidationErrors)),
+		}
+	}
+
+	if req.Alias != "" {
+		if err := opts.Aliases.Check(req.Alias); err != nil {
+			return database.Link{}, &RequestError{Err: err, resp: response.InvalidField("Alias", "alias", err.Error())}
+		}
+	}
+
+	if err := utm.Check(req.Params); err != nil {
+		return database.Link{}, &RequestError{Err: err, resp: response.InvalidField("Params", "params", err.Error())}
+	}
+
+	if req.Password != "" {
+		if err := linklock.Check(req.Password); err != nil {
+			return database.Link{}, &RequestError{Err: err, resp: response.InvalidField("Password", "password", err.Error())}
+		}
+	}
+
+	expiresAt, err := Expiry(req, now)
+	if err != nil {
+		return database.Link{}, &RequestError{Err: err, resp: response.Error(err.Error())}
+	}
+
+	activeFrom, err := ActiveFrom(req, expiresAt)
+	if err != nil {
+		return database.Link{}, &RequestError{Err: err, resp: response.Error(err.Error())}
+	}
+
+	destination, err := Destination(req.Alias, req.URL, opts)
+	if err != nil {
+		var destErr *DestinationError
+		if errors.As(err, &destErr) {
+			return database.Link{}, &RequestError{Err: err, resp: destErr.Response()}
+		}
+		return database.Link{}, fmt.Errorf("%s:%w", mark, err)
+	}
+
+	link := database.Link{
+		URL:          destination,
+		Alias:        req.Alias,
+		ExpiresAt:    expiresAt,
+		ActiveFrom:   activeFrom,
+		RedirectCode: req.Redirect,
+		ForwardQuery: req.ForwardQuery,
+		ForwardPath:  req.ForwardPath,
+		Params:       req.Params,
+		VisitsLeft:   VisitsLeft(req),
+	}
+
+	if req.Password != "" {
+		if link.PasswordHash, err = linklock.Hash(req.Password); err != nil {
+			return database.Link{}, fmt.Errorf("%s:%w", mark, err)
+		}
+	}
+
+	return link, nil
+}
+
+// GenerateAlias makes aliases with gen and rejects reserved words, so a generated alias
+// can never be shadowed by a route. The storage then goes on to the next attempt.
+func GenerateAlias(gen alias.Generator, rules *alias.Rules) database.AliasFunc {
+	return func(id int64, attempt int) (string, error) {
+		generated, err := gen.Generate(id, attempt)
+		if err != nil {
+			return "", err
+		}
+		if rules.Reserved(generated) {
+			return "", fmt.Errorf("%w: %q is reserved", database.ErrAliasRejected, generated)
+		}
+
+		return generated, nil
+	}
+}
+
+// Destination turns the requested url of a link into the one to store: canonical,
+// flattened when it is one of our own short links and allowed by the policy.
+// Urls the client can not save fail with a *DestinationError, other errors are internal.
+func Destination(alias, rawURL string, opts Options) (string, error) {
+	canonical, err := urlnorm.Normalize(rawURL, opts.Normalize)
+	if err != nil {
+		return "", &DestinationError{Tag: "url", Err: errors.New("invalid url")}
+	}
+
+	final, err := opts.SelfLinks.Resolve(alias, canonical)
+	if err != nil {
+		if errors.Is(err, selflink.ErrCycle) || errors.Is(err, selflink.ErrTooDeep) || errors.Is(err, selflink.ErrTargetNotFound) ||
+			errors.Is(err, selflink.ErrPathNotForwarded) {
+			return "", &DestinationError{Tag: "self_link", Err: err}
+		}
+		return "", err
+	}
+
+	if err := opts.Policy.Check(final); err != nil {
+		return "", &DestinationError{Tag: "policy", Err: err}
+	}
+
+	return final, nil
+}
+
+// ActiveFrom resolves when the requested link starts redirecting, nil means right away.
+// expiresAt is the resolved expiry of the link.
+func ActiveFrom(req Request, expiresAt *time.Time) (*time.Time, error) {
+	if req.ActiveFrom == nil {
+		return nil, nil
+	}
+
+	if expiresAt != nil && !req.ActiveFrom.Before(*expiresAt) {
+		return nil, ErrEmptyWindow
+	}
+
+	activeFrom := req.ActiveFrom.UTC()
+
+	return &activeFrom, nil
+}
+
+// VisitsLeft is how many redirects a new link serves, nil means no limit
+func VisitsLeft(req Request) *int {
+	if req.MaxVisits == 0 {
+		return nil
+	}
+
+	left := req.MaxVisits
+
+	return &left
+}
+
+// Expiry resolves when the requested link stops working, nil means never
+func Expiry(req Request, now time.Time) (*time.Time, error) {
+	if req.ActiveUntil != nil {
+		if req.ExpiresAt != nil || req.TTL != "" {
+			return nil, ErrExpiryConflict
+		}
+		req.ExpiresAt = req.ActiveUntil
+	}
+
+	switch {
+	case req.ExpiresAt != nil && req.TTL != "":
+		return nil, ErrExpiryConflict
+
+	case req.ExpiresAt != nil:
+		if !req.ExpiresAt.After(now) {
+			return nil, ErrExpiryInPast
+		}
+		expiresAt := req.ExpiresAt.UTC()
+		return &expiresAt, nil
+
+	case req.TTL != "":
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			return nil, ErrInvalidTTL
+		}
+		expiresAt := now.Add(ttl).UTC()
+		return &expiresAt, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,120 @@
+package urlstats
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/database"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/response"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/slogg"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type Response struct {
+	response.Response
+	Alias   string   `json:"alias,omitempty"`
+	Total   int64    `json:"total"`
+	Bucket  string   `json:"bucket,omitempty"`
+	Buckets []Bucket `json:"buckets"`
+}
+
+type Bucket struct {
+	Start time.Time `json:"start"`
+	Count int64     `json:"count"`
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.28.2 --name=StatsGetter
+type StatsGetter interface {
+	GetStats(alias string, since time.Time, bucket time.Duration) (database.Stats, error)
+}
+
+// bucket sizes accepted in the bucket query parameter
+var buckets = map[string]time.Duration{
+	"hour": time.Hour,
+	"day":  24 * time.Hour,
+}
+
+const (
+	defaultBucket = "hour"
+	defaultPeriod = 7 * 24 * time.Hour // how far back buckets go when since is not set
+)
+
+// New serves GET /url/{alias}/stats?bucket=hour|day&since=<RFC 3339>
+func New(log *slog.Logger, statsGetter StatsGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const mark = "handlers.url-stats.New"
+
+		log := log.With(
+			slog.String("mark", mark),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		alias := chi.URLParam(r, "alias")
+		if alias == "" {
+			log.Info("alias is empty")
+
+			response.JSON(w, r, response.Error("invalid request"))
+
+			return
+		}
+
+		bucketName := r.URL.Query().Get("bucket")
+		if bucketName == "" {
+			bucketName = defaultBucket
+		}
+
+		bucket, ok := buckets[bucketName]
+		if !ok {
+			log.Info("invalid bucket", slog.String("bucket", bucketName))
+
+			response.JSON(w, r, response.Error("bucket must be hour or day"))
+
+			return
+		}
+
+		since := time.Now().Add(-defaultPeriod)
+		if s := r.URL.Query().Get("since"); s != "" {
+			var err error
+			since, err = time.Parse(time.RFC3339, s)
+			if err != nil {
+				log.Info("invalid since", slog.String("since", s))
+
+				response.JSON(w, r, response.Error("since must be an RFC 3339 time"))
+
+				return
+			}
+		}
+
+		stats, err := statsGetter.GetStats(alias, since, bucket)
+		if err != nil {
+			if errors.Is(err, database.ErrURLNotFound) {
+				log.Info("url not found", "alias", alias)
+
+				response.JSON(w, r, response.NotFound("not found"))
+
+				return
+			}
+			log.Error("failed to get stats", slogg.Err(err))
+
+			response.JSON(w, r, response.Internal("internal error"))
+
+			return
+		}
+
+		resp := Response{
+			Response: response.OK(),
+			Alias:    alias,
+			Total:    stats.Total,
+			Bucket:   bucketName,
+			Buckets:  make([]Bucket, 0, len(stats.Buckets)),
+		}
+		for _, b := range stats.Buckets {
+			resp.Buckets = append(resp.Buckets, Bucket{Start: b.Start, Count: b.Count})
+		}
+
+		response.JSON(w, r, resp)
+	}
+}
@@ -0,0 +1,106 @@
+package updatetests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/database"
+	urlsave "github.com/FacelessWayfarer/urlshortner/internal/handlers/url-save"
+	"github.com/FacelessWayfarer/urlshortner/internal/handlers/url-save/test/mocks"
+	urlupdate "github.com/FacelessWayfarer/urlshortner/internal/handlers/url-update"
+	discardslogg "github.com/FacelessWayfarer/urlshortner/internal/lib/discard-slogg"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateHandle(t *testing.T) {
+	cases := []struct {
+		name      string
+		alias     string
+		url       string
+		canonical string // stored url, the request url when empty
+		previous  string
+		respError string
+		mockError error
+	}{
+		{
+			name:     "Success",
+			alias:    "test_alias",
+			url:      "https://yandex.ru/",
+			previous: "https://google.com",
+		},
+		{
+			name:      "Canonical URL",
+			alias:     "test_alias",
+			url:       "HTTPS://Yandex.RU:443/a/../b",
+			canonical: "https://yandex.ru/b",
+			previous:  "https://google.com",
+		},
+		{
+			name:      "Invalid URL",
+			alias:     "test_alias",
+			url:       "not a url",
+			respError: "field URL is not a valid URL",
+		},
+		{
+			name:      "Not found",
+			alias:     "test_alias",
+			url:       "https://yandex.ru/",
+			respError: "not found",
+			mockError: database.ErrURLNotFound,
+		},
+		{
+			name:      "UpdateURL Error",
+			alias:     "test_alias",
+			url:       "https://yandex.ru/",
+			respError: "failed to update url",
+			mockError: errors.New("unexpected error"),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			urlUpdaterMock := mocks.NewURLUpdater(t)
+
+			canonical := tc.canonical
+			if canonical == "" {
+				canonical = tc.url
+			}
+
+			if tc.respError == "" || tc.mockError != nil {
+				urlUpdaterMock.On("UpdateURL", tc.alias, canonical).
+					Return(tc.previous, tc.mockError).
+					Once()
+			}
+
+			r := chi.NewRouter()
+			r.Patch("/url/{alias}", urlupdate.New(discardslogg.NewDiscardLogger(), urlUpdaterMock, urlsave.Options{}))
+
+			input := fmt.Sprintf(`{"url": "%s"}`, tc.url)
+
+			req, err := http.NewRequest(http.MethodPatch, "/url/"+tc.alias, bytes.NewReader([]byte(input)))
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			var resp urlupdate.Response
+
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+			require.Equal(t, tc.respError, resp.Error)
+
+			if tc.respError == "" {
+				require.Equal(t, canonical, resp.URL)
+				require.Equal(t, tc.previous, resp.PreviousURL)
+			}
+		})
+	}
+}
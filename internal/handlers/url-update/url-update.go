@@ -0,0 +1,126 @@
+package urlupdate
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/database"
+	urlsave "github.com/FacelessWayfarer/urlshortner/internal/handlers/url-save"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/response"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/slogg"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+)
+
+type Request struct {
+	URL string `json:"url" validate:"required,url"`
+}
+
+type Response struct {
+	response.Response
+	Alias       string `json:"alias,omitempty"`
+	URL         string `json:"url,omitempty"`
+	PreviousURL string `json:"previous_url,omitempty"`
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.28.2 --name=URLUpdater
+type URLUpdater interface {
+	UpdateURL(alias, url string) (previous string, err error)
+}
+
+// New serves PATCH /url/{alias}, retargeting the alias in one step.
+// The new url goes through the same checks as on save, opts.Dedup does not apply.
+func New(log *slog.Logger, urlUpdater URLUpdater, opts urlsave.Options) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const mark = "handlers.url-update.New"
+
+		log := log.With(
+			slog.String("mark", mark),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		alias := chi.URLParam(r, "alias")
+		if alias == "" {
+			log.Info("alias is empty")
+
+			response.JSON(w, r, response.Error("invalid request"))
+
+			return
+		}
+
+		var req Request
+
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			if errors.Is(err, io.EOF) {
+				log.Error("request body is empty")
+
+				response.JSON(w, r, response.Error("empty request"))
+
+				return
+			}
+			log.Error("failed to decode request body", slogg.Err(err))
+
+			response.JSON(w, r, response.Error("failed to decode request"))
+
+			return
+		}
+
+		log.Info("request body decoded", slog.Any("request", req))
+
+		if err := validator.New().Struct(req); err != nil {
+			validateErr := err.(validator.ValidationErrors)
+
+			log.Error("invalid request", slogg.Err(err))
+
+			response.JSON(w, r, response.ValidationError(validateErr))
+
+			return
+		}
+
+		destination, err := urlsave.Destination(alias, req.URL, opts)
+		if err != nil {
+			var destErr *urlsave.DestinationError
+			if errors.As(err, &destErr) {
+				log.Info("url rejected", slog.String("url", req.URL), slogg.Err(err))
+
+				response.JSON(w, r, destErr.Response())
+
+				return
+			}
+			log.Error("failed to resolve url", slogg.Err(err))
+
+			response.JSON(w, r, response.Internal("failed to update url"))
+
+			return
+		}
+
+		previous, err := urlUpdater.UpdateURL(alias, destination)
+		if err != nil {
+			if errors.Is(err, database.ErrURLNotFound) {
+				log.Info("url not found", "alias", alias)
+
+				response.JSON(w, r, response.NotFound("not found"))
+
+				return
+			}
+			log.Error("failed to update url", slogg.Err(err))
+
+			response.JSON(w, r, response.Internal("failed to update url"))
+
+			return
+		}
+
+		log.Info("url updated", slog.String("alias", alias), slog.String("previous_url", previous))
+
+		response.JSON(w, r, Response{
+			Response:    response.OK(),
+			Alias:       alias,
+			URL:         destination,
+			PreviousURL: previous,
+		})
+	}
+}
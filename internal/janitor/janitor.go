@@ -0,0 +1,40 @@
+package janitor
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/slogg"
+)
+
+type ExpiredRemover interface {
+	DeleteExpired(now time.Time) (int64, error)
+}
+
+// Run purges expired urls every interval until ctx is cancelled
+func Run(ctx context.Context, log *slog.Logger, remover ExpiredRemover, interval time.Duration) {
+	const mark = "janitor.Run"
+
+	log = log.With(slog.String("mark", mark))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("janitor stopped")
+			return
+		case now := <-ticker.C:
+			n, err := remover.DeleteExpired(now)
+			if err != nil {
+				log.Error("failed to purge expired urls", slogg.Err(err))
+				continue
+			}
+			if n > 0 {
+				log.Info("purged expired urls", slog.Int64("count", n))
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package janitortests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/database"
+	"github.com/FacelessWayfarer/urlshortner/internal/database/memory"
+	"github.com/FacelessWayfarer/urlshortner/internal/janitor"
+	discardslogg "github.com/FacelessWayfarer/urlshortner/internal/lib/discard-slogg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	db := memory.New()
+
+	past := time.Now().Add(-time.Minute)
+
+	_, err := db.SaveURL(database.Link{URL: "https://google.com", Alias: "expired", ExpiresAt: &past})
+	require.NoError(t, err)
+	_, err = db.SaveURL(database.Link{URL: "https://google.com", Alias: "permanent"})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		janitor.Run(ctx, discardslogg.NewDiscardLogger(), db, 10*time.Millisecond)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		_, err := db.GetURL("expired")
+		return errors.Is(err, database.ErrURLNotFound)
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+
+	_, err = db.GetURL("permanent")
+	require.NoError(t, err)
+}
@@ -0,0 +1,115 @@
+// Package linklock gates links behind a password: hashing it for storage,
+// checking guesses and throttling them per alias.
+package linklock
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	MinLength = 4
+	MaxLength = 72 // bytes, bcrypt ignores the rest
+
+	DefaultMaxAttempts = 5
+	DefaultWindow      = 15 * time.Minute
+)
+
+var ErrPasswordLength = errors.New("password length is out of range")
+
+// Check reports why password can not gate a link
+func Check(password string) error {
+	if len(password) < MinLength || len(password) > MaxLength {
+		return fmt.Errorf("%w: must be from %d to %d bytes", ErrPasswordLength, MinLength, MaxLength)
+	}
+
+	return nil
+}
+
+// Hash makes the form a password is stored in
+func Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// Verify reports whether password is the one hash was made from
+func Verify(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// Limiter allows maxAttempts guesses per alias within a window starting at the first one,
+// it is safe for concurrent use and forgets everything on restart
+type Limiter struct {
+	mu          sync.Mutex
+	maxAttempts int
+	window      time.Duration
+	attempts    map[string]*attempts
+}
+
+type attempts struct {
+	count int
+	since time.Time
+}
+
+// sweepAt is how many aliases are tracked before windows that are over get dropped
+const sweepAt = 1024
+
+// NewLimiter makes a Limiter, zero values fall back to DefaultMaxAttempts and DefaultWindow
+func NewLimiter(maxAttempts int, window time.Duration) *Limiter {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	if window <= 0 {
+		window = DefaultWindow
+	}
+
+	return &Limiter{
+		maxAttempts: maxAttempts,
+		window:      window,
+		attempts:    make(map[string]*attempts),
+	}
+}
+
+// Attempt counts a guess for alias made at now. When the alias has none left it returns false
+// and how long until the window is over, the guess must not be checked then.
+func (l *Limiter) Attempt(alias string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.attempts) >= sweepAt {
+		for a, at := range l.attempts {
+			if !now.Before(at.since.Add(l.window)) {
+				delete(l.attempts, a)
+			}
+		}
+	}
+
+	at, ok := l.attempts[alias]
+	if !ok || !now.Before(at.since.Add(l.window)) {
+		at = &attempts{since: now}
+		l.attempts[alias] = at
+	}
+
+	if at.count >= l.maxAttempts {
+		return at.since.Add(l.window).Sub(now), false
+	}
+	at.count++
+
+	return 0, true
+}
+
+// Succeed forgets the guesses of alias once the right password was given
+func (l *Limiter) Succeed(alias string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.attempts, alias)
+}
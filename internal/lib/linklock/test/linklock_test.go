@@ -0,0 +1,52 @@
+package linklocktest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/linklock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHash(t *testing.T) {
+	hash, err := linklock.Hash("s3cret")
+	require.NoError(t, err)
+	require.NotContains(t, hash, "s3cret")
+
+	require.True(t, linklock.Verify(hash, "s3cret"))
+	require.False(t, linklock.Verify(hash, "S3cret"))
+	require.False(t, linklock.Verify("", ""))
+}
+
+func TestCheck(t *testing.T) {
+	require.NoError(t, linklock.Check("s3cret"))
+	require.ErrorIs(t, linklock.Check("abc"), linklock.ErrPasswordLength)
+	require.ErrorIs(t, linklock.Check(strings.Repeat("a", linklock.MaxLength+1)), linklock.ErrPasswordLength)
+}
+
+func TestLimiter(t *testing.T) {
+	l := linklock.NewLimiter(2, time.Minute)
+	now := time.Now()
+
+	for range 2 {
+		_, ok := l.Attempt("docs", now)
+		require.True(t, ok)
+	}
+
+	retryAfter, ok := l.Attempt("docs", now.Add(10*time.Second))
+	require.False(t, ok)
+	require.Equal(t, 50*time.Second, retryAfter)
+
+	_, ok = l.Attempt("other", now)
+	require.True(t, ok, "aliases are throttled separately")
+
+	_, ok = l.Attempt("docs", now.Add(time.Minute))
+	require.True(t, ok, "a new window starts once the old one is over")
+
+	l.Succeed("docs")
+	for range 2 {
+		_, ok := l.Attempt("docs", now.Add(time.Minute))
+		require.True(t, ok)
+	}
+}
@@ -1,20 +1,18 @@
 package random
 
 import (
-	"math/rand"
-	"time"
+	"math/rand/v2"
 )
 
+// NewRandomString is not suitable for aliases, see the alias package for those
 func NewRandomString(length int) string {
-	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
-
 	chars := []rune("ABCDEFGHIJKLMNOPQRSTUVWXYZ" +
 		"abcdefghijklmnopqrstuvwxyz" +
 		"0123456789")
 
 	alias := make([]rune, length)
 	for i := range alias {
-		alias[i] = chars[rnd.Intn(len(chars))]
+		alias[i] = chars[rand.IntN(len(chars))]
 	}
 
 	return string(alias)
@@ -0,0 +1,71 @@
+package response
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const ContentTypeProblem = "application/problem+json"
+
+// Problem is an RFC 7807 error body
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"` // request id
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Tag     string `json:"tag"` // failed validation rule
+	Message string `json:"message"`
+}
+
+// problem converts an error response, ok is false for successful ones
+func (resp Response) problem(r *http.Request) (Problem, bool) {
+	if resp.Status != StatusError {
+		return Problem{}, false
+	}
+
+	status := resp.StatusCode()
+
+	return Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   resp.Error,
+		Instance: middleware.GetReqID(r.Context()),
+		Errors:   resp.Fields,
+	}, true
+}
+
+type problemer interface {
+	problem(r *http.Request) (Problem, bool)
+}
+
+// WantsProblem reports whether the Accept header of r lists problem+json
+func WantsProblem(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType != ContentTypeProblem {
+			continue
+		}
+		if q, ok := params["q"]; ok && strings.Trim(q, "0.") == "" {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func writeProblem(w http.ResponseWriter, p Problem) {
+	w.Header().Set("Content-Type", ContentTypeProblem+"; charset=utf-8")
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
@@ -1,15 +1,22 @@
 package response
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"strings"
 
+	"github.com/go-chi/render"
 	"github.com/go-playground/validator/v10"
 )
 
 type Response struct {
 	Status string `json:"status"`
 	Error  string `json:"error,omitempty"`
+	// HTTPStatus is the status JSON writes the response with, zero means 200
+	HTTPStatus int `json:"-"`
+	// Fields are per-field validation errors, only problem+json bodies carry them
+	Fields []FieldError `json:"-"`
 }
 
 const (
@@ -17,35 +24,116 @@ const (
 	StatusError = "Error"
 )
 
+// StatusCoder is a response that knows its HTTP status,
+// structs embedding Response implement it
+type StatusCoder interface {
+	StatusCode() int
+}
+
+func (r Response) StatusCode() int {
+	if r.HTTPStatus == 0 {
+		return http.StatusOK
+	}
+	return r.HTTPStatus
+}
+
 func OK() Response {
 	return Response{
 		Status: StatusOK,
 	}
 }
 
+// Error is a client error, it is sent with 400
 func Error(msg string) Response {
+	return ErrorWithStatus(http.StatusBadRequest, msg)
+}
+
+func NotFound(msg string) Response {
+	return ErrorWithStatus(http.StatusNotFound, msg)
+}
+
+func Conflict(msg string) Response {
+	return ErrorWithStatus(http.StatusConflict, msg)
+}
+
+func Gone(msg string) Response {
+	return ErrorWithStatus(http.StatusGone, msg)
+}
+
+func Internal(msg string) Response {
+	return ErrorWithStatus(http.StatusInternalServerError, msg)
+}
+
+func ErrorWithStatus(status int, msg string) Response {
 	return Response{
-		Status: StatusError,
-		Error:  msg,
+		Status:     StatusError,
+		Error:      msg,
+		HTTPStatus: status,
 	}
 }
 
 func ValidationError(errs validator.ValidationErrors) Response {
-	var errMsgs []string
+	fields := make([]FieldError, 0, len(errs))
+	errMsgs := make([]string, 0, len(errs))
 
 	for _, err := range errs {
+		var msg string
 		switch err.ActualTag() {
 		case "required":
-			errMsgs = append(errMsgs, fmt.Sprintf("field %s is a required field", err.Field()))
+			msg = fmt.Sprintf("field %s is a required field", err.Field())
 		case "url":
-			errMsgs = append(errMsgs, fmt.Sprintf("field %s is not a valid URL", err.Field()))
+			msg = fmt.Sprintf("field %s is not a valid URL", err.Field())
+		case "oneof":
+			msg = fmt.Sprintf("field %s must be one of %s", err.Field(), err.Param())
+		case "min":
+			msg = fmt.Sprintf("field %s must be at least %s", err.Field(), err.Param())
 		default:
-			errMsgs = append(errMsgs, fmt.Sprintf("field %s is not valid", err.Field()))
+			msg = fmt.Sprintf("field %s is not valid", err.Field())
 		}
+
+		fields = append(fields, FieldError{Field: err.Field(), Tag: err.ActualTag(), Message: msg})
+		errMsgs = append(errMsgs, msg)
 	}
 
-	return Response{
-		Status: StatusError,
-		Error:  strings.Join(errMsgs, ", "),
+	resp := Error(strings.Join(errMsgs, ", "))
+	resp.Fields = fields
+
+	return resp
+}
+
+// InvalidField is a 400 for a field that failed a check done outside the validator
+func InvalidField(field, tag, msg string) Response {
+	resp := Error(msg)
+	resp.Fields = []FieldError{{Field: field, Tag: tag, Message: msg}}
+
+	return resp
+}
+
+// JSON renders resp with the HTTP status it carries.
+// Error responses become problem+json when the client accepts it, those always keep their real status.
+func JSON(w http.ResponseWriter, r *http.Request, resp StatusCoder) {
+	if p, ok := resp.(problemer); ok && WantsProblem(r) {
+		if problem, ok := p.problem(r); ok {
+			writeProblem(w, problem)
+			return
+		}
+	}
+
+	status := resp.StatusCode()
+	if legacy, _ := r.Context().Value(legacyKey{}).(bool); legacy {
+		status = http.StatusOK
 	}
+
+	render.Status(r, status)
+	render.JSON(w, r, resp)
+}
+
+type legacyKey struct{}
+
+// LegacyStatusCodes is a middleware for clients written before errors had their own HTTP statuses,
+// JSON sends every response under it with 200
+func LegacyStatusCodes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), legacyKey{}, true)))
+	})
 }
@@ -0,0 +1,106 @@
+package responsetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/response"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/require"
+)
+
+type request struct {
+	URL   string `validate:"required,url"`
+	Alias string `validate:"required"`
+}
+
+// embedded mirrors how handlers wrap response.Response
+type embedded struct {
+	response.Response
+	Alias string `json:"alias,omitempty"`
+}
+
+func validationHandler(w http.ResponseWriter, r *http.Request) {
+	err := validator.New().Struct(request{URL: "not a url"})
+	response.JSON(w, r, embedded{Response: response.ValidationError(err.(validator.ValidationErrors))})
+}
+
+func serve(t *testing.T, h http.HandlerFunc, accept string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	rr := httptest.NewRecorder()
+	middleware.RequestID(h).ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestJSON_Problem(t *testing.T) {
+	rr := serve(t, validationHandler, "application/problem+json, application/json;q=0.5")
+
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, "application/problem+json; charset=utf-8", rr.Header().Get("Content-Type"))
+
+	var p response.Problem
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &p))
+
+	require.Equal(t, "about:blank", p.Type)
+	require.Equal(t, "Bad Request", p.Title)
+	require.Equal(t, http.StatusBadRequest, p.Status)
+	require.NotEmpty(t, p.Instance)
+	require.Equal(t, []response.FieldError{
+		{Field: "URL", Tag: "url", Message: "field URL is not a valid URL"},
+		{Field: "Alias", Tag: "required", Message: "field Alias is a required field"},
+	}, p.Errors)
+}
+
+func TestJSON_PlainError(t *testing.T) {
+	rr := serve(t, validationHandler, "application/json")
+
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Contains(t, rr.Header().Get("Content-Type"), "application/json")
+
+	var resp embedded
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+	require.Equal(t, response.StatusError, resp.Status)
+	require.Equal(t, "field URL is not a valid URL, field Alias is a required field", resp.Error)
+}
+
+func TestJSON_ProblemIgnoresSuccess(t *testing.T) {
+	rr := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		response.JSON(w, r, embedded{Response: response.OK(), Alias: "alias"})
+	}, "application/problem+json")
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Contains(t, rr.Header().Get("Content-Type"), "application/json")
+	require.JSONEq(t, `{"status":"OK","alias":"alias"}`, rr.Body.String())
+}
+
+func TestWantsProblem(t *testing.T) {
+	cases := []struct {
+		accept string
+		want   bool
+	}{
+		{accept: "", want: false},
+		{accept: "application/json", want: false},
+		{accept: "application/problem+json", want: true},
+		{accept: "text/html, application/problem+json;q=0.9", want: true},
+		{accept: "application/problem+json;q=0", want: false},
+		{accept: "application/problem+json;q=0.000", want: false},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", tc.accept)
+
+		require.Equal(t, tc.want, response.WantsProblem(req), tc.accept)
+	}
+}
@@ -0,0 +1,216 @@
+// Package selflink follows destinations that are short links of this service,
+// so links point at the final target instead of chaining through other aliases.
+package selflink
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/alias"
+	"github.com/FacelessWayfarer/urlshortner/internal/database"
+	"golang.org/x/net/idna"
+)
+
+const DefaultMaxDepth = 5
+
+var (
+	ErrCycle            = errors.New("short link points back at itself")
+	ErrTooDeep          = errors.New("too many short links in a row")
+	ErrTargetNotFound   = errors.New("short link destination does not exist")
+	ErrPathNotForwarded = errors.New("short link does not forward paths")
+)
+
+type URLGetter interface {
+	GetURL(alias string) (database.Link, error)
+}
+
+type Config struct {
+	// Hosts are the public hosts short links are served on, ports are ignored
+	Hosts []string
+	// MaxDepth is how many short links may be followed for one url, zero means DefaultMaxDepth
+	MaxDepth int
+	// CaseInsensitive matches the storage treating aliases that differ only in case as the same alias
+	CaseInsensitive bool
+	// Aliases tell route segments from aliases by their reserved words, nil takes every first segment for an alias
+	Aliases *alias.Rules
+}
+
+// Resolver is safe for concurrent use, a nil Resolver leaves every url as is
+type Resolver struct {
+	hosts     map[string]bool
+	urlGetter URLGetter
+	maxDepth  int
+	nocase    bool
+	aliases   *alias.Rules
+}
+
+// New makes a Resolver for short links on the configured hosts
+func New(cfg Config, urlGetter URLGetter) *Resolver {
+	maxDepth := cfg.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+
+	r := &Resolver{
+		hosts:     make(map[string]bool, len(cfg.Hosts)),
+		urlGetter: urlGetter,
+		maxDepth:  maxDepth,
+		nocase:    cfg.CaseInsensitive,
+		aliases:   cfg.Aliases,
+	}
+	for _, host := range cfg.Hosts {
+		host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+		if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+			host = ascii
+		}
+		if host != "" {
+			r.hosts[host] = true
+		}
+	}
+
+	return r
+}
+
+// Resolve follows rawURL through short links of this service and returns the url it finally leads to.
+// alias is the link rawURL belongs to, it is empty while the alias is not known yet.
+// Short links with their own redirect code are not flattened, so every hop redirects with the code of its own link.
+// Neither are urls with a path past the alias, a query or a fragment. The chain is checked for cycles and depth past such links too, visitors still follow every hop of it.
+func (r *Resolver) Resolve(alias, rawURL string) (string, error) {
+	const mark = "selflink.Resolve"
+
+	if r == nil || len(r.hosts) == 0 {
+		return rawURL, nil
+	}
+
+	seen := make(map[string]bool, r.maxDepth+1)
+	if alias != "" {
+		seen[r.key(alias)] = true
+	}
+
+	// kept is the url to store once a link on the chain may not be skipped
+	var kept string
+
+	for depth := 0; ; depth++ {
+		next, ok := r.target(rawURL)
+		if !ok {
+			if kept != "" {
+				return kept, nil
+			}
+			return rawURL, nil
+		}
+
+		if seen[r.key(next.alias)] {
+			return "", fmt.Errorf("%w %q", ErrCycle, next.alias)
+		}
+		if depth == r.maxDepth {
+			return "", ErrTooDeep
+		}
+		seen[r.key(next.alias)] = true
+
+		link, err := r.urlGetter.GetURL(next.alias)
+		if err != nil {
+			if errors.Is(err, database.ErrURLNotFound) {
+				return "", fmt.Errorf("%w %q", ErrTargetNotFound, next.alias)
+			}
+			return "", fmt.Errorf("%s:%w", mark, err)
+		}
+		if link.Expired(time.Now()) {
+			return "", fmt.Errorf("%w %q", ErrTargetNotFound, next.alias)
+		}
+		if next.suffix != "" && !link.ForwardPath {
+			// visitors would get a 404 from it
+			return "", fmt.Errorf("%w %q", ErrPathNotForwarded, next.alias)
+		}
+		if kept == "" && (next.suffix != "" || next.extra || !flattenable(link)) {
+			kept = rawURL
+		}
+
+		rawURL = link.URL
+		if next.suffix != "" {
+			if rawURL, err = appendPath(rawURL, next.suffix); err != nil {
+				return "", fmt.Errorf("%s:%w", mark, err)
+			}
+		}
+	}
+}
+
+// flattenable tells whether link may be skipped by pointing straight at its destination
+func flattenable(link database.Link) bool {
+	if link.PasswordHash != "" || link.VisitsLeft != nil || link.ActiveFrom != nil || link.ExpiresAt != nil || len(link.Params) > 0 {
+		// flattening would skip its password prompt, visit count, launch time, expiry or query parameters
+		return false
+	}
+	if link.ForwardQuery || link.ForwardPath {
+		// the query and path visitors add would no longer reach it
+		return false
+	}
+	// each link redirects with its own code: the outer one sends visitors here,
+	// this one takes them on with the code it was saved with
+	return link.RedirectCode == 0
+}
+
+// key is how alias is told apart from the others on the chain
+func (r *Resolver) key(alias string) string {
+	if r.nocase {
+		// the storage folds ascii letters only
+		return asciiLower(alias)
+	}
+	return alias
+}
+
+func asciiLower(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+// target is the short link of this service a url points at
+type target struct {
+	alias  string
+	suffix string // escaped path that follows the alias, without the leading slash
+	extra  bool   // the url has a query or a fragment
+}
+
+// target parses urls of the form https://{public host}/{alias}[/{suffix}],
+// first segments reserved for routes are not aliases
+func (r *Resolver) target(rawURL string) (target, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || !r.hosts[strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")] {
+		return target{}, false
+	}
+
+	alias, suffix, _ := strings.Cut(strings.TrimPrefix(u.EscapedPath(), "/"), "/")
+	if alias == "" || r.aliases.Reserved(alias) {
+		return target{}, false
+	}
+
+	return target{
+		alias:  alias,
+		suffix: suffix,
+		extra:  u.RawQuery != "" || u.Fragment != "",
+	}, true
+}
+
+// appendPath forwards suffix to destination the way a link with ForwardPath does
+func appendPath(destination, suffix string) (string, error) {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+
+	rawPath := strings.TrimSuffix(u.EscapedPath(), "/") + "/" + suffix
+	path, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return "", err
+	}
+	u.Path, u.RawPath = path, rawPath
+
+	return u.String(), nil
+}
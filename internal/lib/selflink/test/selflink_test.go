@@ -0,0 +1,206 @@
+package selflinktest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/alias"
+	"github.com/FacelessWayfarer/urlshortner/internal/database"
+	"github.com/FacelessWayfarer/urlshortner/internal/database/memory"
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/selflink"
+	"github.com/stretchr/testify/require"
+)
+
+func save(t *testing.T, db *memory.Database, alias, url string) {
+	t.Helper()
+
+	_, err := db.SaveURL(database.Link{Alias: alias, URL: url})
+	require.NoError(t, err)
+}
+
+func TestResolve(t *testing.T) {
+	db := memory.New()
+	save(t, db, "a", "https://example.com/")
+	save(t, db, "b", "https://sho.rt/a")
+	save(t, db, "c", "https://SHO.rt:8080/b")
+
+	rules, err := alias.NewRules(0, 0, []string{"url"})
+	require.NoError(t, err)
+
+	resolver := selflink.New(selflink.Config{Hosts: []string{"sho.rt"}, Aliases: rules}, db)
+
+	cases := map[string]string{
+		"https://example.com/":       "https://example.com/",
+		"https://sho.rt/":            "https://sho.rt/",
+		"https://sho.rt/url/a":       "https://sho.rt/url/a",
+		"https://sho.rt/a":           "https://example.com/",
+		"https://sho.rt/c?utm=1#x":   "https://sho.rt/c?utm=1#x",
+		"https://sho.rt/c#x":         "https://sho.rt/c#x",
+		"https://other.host/a":       "https://other.host/a",
+		"http://sho.rt./b":           "https://example.com/",
+		"https://sub.sho.rt/a":       "https://sub.sho.rt/a",
+		"mailto:someone@example.com": "mailto:someone@example.com",
+	}
+	for raw, want := range cases {
+		got, err := resolver.Resolve("", raw)
+		require.NoError(t, err, raw)
+		require.Equal(t, want, got, raw)
+	}
+
+	_, err = resolver.Resolve("", "https://sho.rt/missing")
+	require.ErrorIs(t, err, selflink.ErrTargetNotFound)
+
+	// the link being saved can not lead to itself
+	_, err = resolver.Resolve("a", "https://sho.rt/c")
+	require.ErrorIs(t, err, selflink.ErrCycle)
+}
+
+func TestResolve_Expired(t *testing.T) {
+	db := memory.New()
+
+	expired := time.Now().Add(-time.Minute)
+	_, err := db.SaveURL(database.Link{Alias: "old", URL: "https://example.com/", ExpiresAt: &expired})
+	require.NoError(t, err)
+
+	_, err = selflink.New(selflink.Config{Hosts: []string{"sho.rt"}}, db).Resolve("", "https://sho.rt/old")
+	require.ErrorIs(t, err, selflink.ErrTargetNotFound)
+}
+
+func TestResolve_Forwarding(t *testing.T) {
+	db := memory.New()
+	_, err := db.SaveURL(database.Link{Alias: "docs", URL: "https://example.com/docs", ForwardPath: true})
+	require.NoError(t, err)
+	_, err = db.SaveURL(database.Link{Alias: "search", URL: "https://example.com/?q=go", ForwardQuery: true})
+	require.NoError(t, err)
+	_, err = db.SaveURL(database.Link{Alias: "loop", URL: "https://sho.rt/loop/x", ForwardPath: true})
+	require.NoError(t, err)
+	save(t, db, "plain", "https://example.com/")
+
+	resolver := selflink.New(selflink.Config{Hosts: []string{"sho.rt"}}, db)
+
+	// flattening would drop what visitors add to the path or query of these links
+	for _, raw := range []string{"https://sho.rt/docs", "https://sho.rt/docs/api", "https://sho.rt/search"} {
+		got, err := resolver.Resolve("", raw)
+		require.NoError(t, err, raw)
+		require.Equal(t, raw, got)
+	}
+
+	_, err = resolver.Resolve("", "https://sho.rt/plain/x")
+	require.ErrorIs(t, err, selflink.ErrPathNotForwarded)
+
+	// the path past an alias is a self link too, loop/x leads to loop/x/x and on
+	_, err = resolver.Resolve("loop", "https://sho.rt/loop/x")
+	require.ErrorIs(t, err, selflink.ErrCycle)
+
+	_, err = resolver.Resolve("", "https://sho.rt/loop")
+	require.ErrorIs(t, err, selflink.ErrCycle)
+}
+
+func TestResolve_Expiring(t *testing.T) {
+	db := memory.New()
+
+	expiresAt := time.Now().Add(time.Hour)
+	_, err := db.SaveURL(database.Link{Alias: "promo", URL: "https://example.com/", ExpiresAt: &expiresAt})
+	require.NoError(t, err)
+
+	// a flattened link would keep redirecting after the promo link is gone
+	got, err := selflink.New(selflink.Config{Hosts: []string{"sho.rt"}}, db).Resolve("", "https://sho.rt/promo")
+	require.NoError(t, err)
+	require.Equal(t, "https://sho.rt/promo", got)
+}
+
+func TestResolve_RedirectCode(t *testing.T) {
+	db := memory.New()
+	_, err := db.SaveURL(database.Link{Alias: "moved", URL: "https://example.com/", RedirectCode: 301})
+	require.NoError(t, err)
+	save(t, db, "open", "https://sho.rt/moved")
+
+	// flattening would make the link redirect with the outer link's code instead of its own
+	got, err := selflink.New(selflink.Config{Hosts: []string{"sho.rt"}}, db).Resolve("", "https://sho.rt/open")
+	require.NoError(t, err)
+	require.Equal(t, "https://sho.rt/moved", got)
+}
+
+func TestResolve_Params(t *testing.T) {
+	db := memory.New()
+	_, err := db.SaveURL(database.Link{Alias: "tagged", URL: "https://example.com/p", Params: map[string]string{"utm_source": "x"}})
+	require.NoError(t, err)
+	save(t, db, "open", "https://sho.rt/tagged")
+
+	// the parameters are added when the tagged link itself is visited
+	got, err := selflink.New(selflink.Config{Hosts: []string{"sho.rt"}}, db).Resolve("", "https://sho.rt/open")
+	require.NoError(t, err)
+	require.Equal(t, "https://sho.rt/tagged", got)
+}
+
+func TestResolve_Protected(t *testing.T) {
+	db := memory.New()
+	_, err := db.SaveURL(database.Link{Alias: "secret", URL: "https://example.com/", PasswordHash: "hash"})
+	require.NoError(t, err)
+	save(t, db, "open", "https://sho.rt/secret")
+
+	// the protected link stays in between so its prompt is not skipped
+	got, err := selflink.New(selflink.Config{Hosts: []string{"sho.rt"}}, db).Resolve("", "https://sho.rt/open")
+	require.NoError(t, err)
+	require.Equal(t, "https://sho.rt/secret", got)
+}
+
+func TestResolve_CycleAndDepth(t *testing.T) {
+	db := memory.New()
+	save(t, db, "x", "https://sho.rt/y")
+	save(t, db, "y", "https://sho.rt/x")
+	save(t, db, "1", "https://sho.rt/2")
+	save(t, db, "2", "https://sho.rt/3")
+	save(t, db, "3", "https://example.com/")
+
+	resolver := selflink.New(selflink.Config{Hosts: []string{"sho.rt"}, MaxDepth: 3}, db)
+
+	_, err := resolver.Resolve("", "https://sho.rt/x")
+	require.ErrorIs(t, err, selflink.ErrCycle)
+
+	got, err := resolver.Resolve("", "https://sho.rt/1")
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/", got)
+
+	_, err = selflink.New(selflink.Config{Hosts: []string{"sho.rt"}, MaxDepth: 2}, db).Resolve("", "https://sho.rt/1")
+	require.ErrorIs(t, err, selflink.ErrTooDeep)
+}
+
+func TestResolve_CycleBehindKeptLink(t *testing.T) {
+	db := memory.New()
+	_, err := db.SaveURL(database.Link{Alias: "aaa", URL: "https://sho.rt/bbb", RedirectCode: 301})
+	require.NoError(t, err)
+	_, err = db.SaveURL(database.Link{Alias: "ccc", URL: "https://sho.rt/ddd", PasswordHash: "hash"})
+	require.NoError(t, err)
+	save(t, db, "ddd", "https://sho.rt/ccc")
+
+	resolver := selflink.New(selflink.Config{Hosts: []string{"sho.rt"}}, db)
+
+	// bbb pointing at aaa would redirect forever, though aaa itself is not flattened
+	_, err = resolver.Resolve("bbb", "https://sho.rt/aaa")
+	require.ErrorIs(t, err, selflink.ErrCycle)
+
+	_, err = resolver.Resolve("", "https://sho.rt/ccc")
+	require.ErrorIs(t, err, selflink.ErrCycle)
+
+	_, err = selflink.New(selflink.Config{Hosts: []string{"sho.rt"}, MaxDepth: 1}, db).Resolve("", "https://sho.rt/aaa")
+	require.ErrorIs(t, err, selflink.ErrTooDeep)
+}
+
+func TestResolve_CaseInsensitive(t *testing.T) {
+	db := memory.New()
+	save(t, db, "Loop", "https://sho.rt/next")
+	save(t, db, "next", "https://sho.rt/loop")
+
+	// the storage finds Loop under loop too, so the chain leads back to where it started
+	_, err := selflink.New(selflink.Config{Hosts: []string{"sho.rt"}, CaseInsensitive: true}, db).Resolve("Loop", "https://sho.rt/next")
+	require.ErrorIs(t, err, selflink.ErrCycle)
+}
+
+func TestResolve_Disabled(t *testing.T) {
+	var resolver *selflink.Resolver
+
+	got, err := resolver.Resolve("", "https://sho.rt/a")
+	require.NoError(t, err)
+	require.Equal(t, "https://sho.rt/a", got)
+}
@@ -0,0 +1,56 @@
+package urlnormtest
+
+import (
+	"testing"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/urlnorm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := map[string]string{
+		"https://google.com":                "https://google.com/",
+		"HTTPS://Google.COM/Search?q=Go":    "https://google.com/Search?q=Go",
+		"https://google.com:443/":           "https://google.com/",
+		"http://google.com:80/a":            "http://google.com/a",
+		"http://google.com:8080/a":          "http://google.com:8080/a",
+		"https://google.com:80/":            "https://google.com:80/",
+		"http://[::1]:80/":                  "http://[::1]/",
+		"http://[::1]:8080/":                "http://[::1]:8080/",
+		"https://user@google.com/#top":      "https://user@google.com/#top",
+		"mailto:someone@example.com":        "mailto:someone@example.com",
+		"HTTPS://Example.com:443/a/../b":    "https://example.com/b",
+		"https://example.com/a/./b/../c/":   "https://example.com/a/c/",
+		"https://example.com/..":            "https://example.com/",
+		"https://example.com/a%2Fb/../c":    "https://example.com/c",
+		"https://Пример.рф/":                "https://xn--e1afmkfd.xn--p1ai/",
+		"https://example.com/?utm_source=x": "https://example.com/?utm_source=x",
+	}
+
+	for raw, want := range cases {
+		got, err := urlnorm.Normalize(raw, urlnorm.Options{})
+		require.NoError(t, err, raw)
+		require.Equal(t, want, got, raw)
+	}
+
+	_, err := urlnorm.Normalize("http://[::1", urlnorm.Options{})
+	require.Error(t, err)
+
+	_, err = urlnorm.Normalize("https://exa mple.com/", urlnorm.Options{})
+	require.Error(t, err)
+}
+
+func TestNormalize_StripTracking(t *testing.T) {
+	cases := map[string]string{
+		"https://example.com/?utm_source=x":                    "https://example.com/",
+		"https://example.com/?utm_source=x&a=1&fbclid=2&b=3":   "https://example.com/?a=1&b=3",
+		"https://example.com/?b=2&UTM_Medium=email&a=1#top":    "https://example.com/?b=2&a=1#top",
+		"https://example.com/?gclid=1&utm=keep&utm_campaign=z": "https://example.com/?utm=keep",
+	}
+
+	for raw, want := range cases {
+		got, err := urlnorm.Normalize(raw, urlnorm.Options{StripTracking: true})
+		require.NoError(t, err, raw)
+		require.Equal(t, want, got, raw)
+	}
+}
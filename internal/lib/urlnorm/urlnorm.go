@@ -0,0 +1,108 @@
+// Package urlnorm brings urls that point to the same place to the same canonical form.
+package urlnorm
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var ErrInvalidHost = errors.New("invalid host")
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// trackingParams are query parameters that only tell where a click came from, utm_* ones are matched by prefix
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"yclid":   true,
+	"msclkid": true,
+	"mc_eid":  true,
+}
+
+// Options tune Normalize
+type Options struct {
+	// StripTracking drops utm_* and click id query parameters
+	StripTracking bool
+}
+
+// Normalize lowercases the scheme and host, converts internationalized hosts to punycode,
+// drops default ports, removes dot segments from the path and gives an empty path "/"
+func Normalize(raw string, opts Options) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	if u.Host != "" {
+		if u.Host, err = normalizeHost(u.Scheme, u.Hostname(), u.Port()); err != nil {
+			return "", err
+		}
+	}
+
+	if strings.HasPrefix(u.Path, "/") {
+		// resolving against itself removes dot segments the way RFC 3986 does
+		resolved := u.ResolveReference(&url.URL{Path: u.Path, RawPath: u.RawPath})
+		u.Path, u.RawPath = resolved.Path, resolved.RawPath
+	}
+	if u.Host != "" && u.Opaque == "" && u.Path == "" {
+		u.Path = "/"
+	}
+
+	if opts.StripTracking && u.RawQuery != "" {
+		u.RawQuery = stripTracking(u.RawQuery)
+	}
+
+	return u.String(), nil
+}
+
+func normalizeHost(scheme, host, port string) (string, error) {
+	if defaultPorts[scheme] == port {
+		port = ""
+	}
+
+	if net.ParseIP(host) == nil {
+		ascii, err := idna.Lookup.ToASCII(host)
+		if err != nil {
+			return "", ErrInvalidHost
+		}
+		host = ascii
+	}
+	host = strings.ToLower(host)
+
+	switch {
+	case port != "":
+		return net.JoinHostPort(host, port), nil
+	case strings.Contains(host, ":"):
+		return "[" + host + "]", nil
+	default:
+		return host, nil
+	}
+}
+
+// stripTracking keeps the order of the remaining parameters untouched
+func stripTracking(rawQuery string) string {
+	params := strings.Split(rawQuery, "&")
+
+	kept := params[:0]
+	for _, param := range params {
+		key, _, _ := strings.Cut(param, "=")
+		if key, err := url.QueryUnescape(key); err == nil {
+			key = strings.ToLower(key)
+			if strings.HasPrefix(key, "utm_") || trackingParams[key] {
+				continue
+			}
+		}
+		kept = append(kept, param)
+	}
+
+	return strings.Join(kept, "&")
+}
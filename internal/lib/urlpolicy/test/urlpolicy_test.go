@@ -0,0 +1,116 @@
+package urlpolicytest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/urlpolicy"
+	"github.com/stretchr/testify/require"
+)
+
+func writeList(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "domains.txt")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
+
+func TestCheck_Schemes(t *testing.T) {
+	policy, err := urlpolicy.New(urlpolicy.Config{})
+	require.NoError(t, err)
+
+	require.NoError(t, policy.Check("https://example.com/"))
+	require.NoError(t, policy.Check("http://example.com/"))
+
+	for _, raw := range []string{
+		"javascript:alert(1)",
+		"data:text/html,<script>alert(1)</script>",
+		"file:///etc/passwd",
+		"ftp://example.com/",
+	} {
+		require.ErrorIs(t, policy.Check(raw), urlpolicy.ErrSchemeNotAllowed, raw)
+	}
+
+	policy, err = urlpolicy.New(urlpolicy.Config{Schemes: []string{"https", "mailto"}})
+	require.NoError(t, err)
+
+	require.NoError(t, policy.Check("mailto:someone@example.com"))
+	require.ErrorIs(t, policy.Check("http://example.com/"), urlpolicy.ErrSchemeNotAllowed)
+}
+
+func TestCheck_Private(t *testing.T) {
+	policy, err := urlpolicy.New(urlpolicy.Config{BlockPrivate: true})
+	require.NoError(t, err)
+
+	for _, raw := range []string{
+		"http://127.0.0.1/",
+		"http://10.1.2.3:8080/",
+		"http://192.168.0.1/",
+		"http://169.254.169.254/latest/meta-data",
+		"http://0.0.0.0/",
+		"http://[::1]/",
+		"http://[fd00::1]/",
+		"http://[::ffff:127.0.0.1]/",
+		"http://localhost/",
+		"http://api.localhost./",
+		"http://2130706433/",
+		"http://0x7f.1/",
+		"http://0177.0.0.1/",
+	} {
+		require.ErrorIs(t, policy.Check(raw), urlpolicy.ErrPrivateAddress, raw)
+	}
+
+	for _, raw := range []string{
+		"http://8.8.8.8/",
+		"http://[2001:4860:4860::8888]/",
+		"https://example.com/",
+		"https://1password.com/",
+	} {
+		require.NoError(t, policy.Check(raw), raw)
+	}
+
+	open, err := urlpolicy.New(urlpolicy.Config{})
+	require.NoError(t, err)
+	require.NoError(t, open.Check("http://127.0.0.1/"))
+}
+
+func TestCheck_Domains(t *testing.T) {
+	policy, err := urlpolicy.New(urlpolicy.Config{
+		AllowList: writeList(t, "# partners\nexample.com\n*.example.org\n\n*.пример.рф\n"),
+		DenyList:  writeList(t, "bad.example.org\n"),
+	})
+	require.NoError(t, err)
+
+	for _, raw := range []string{
+		"https://example.com/",
+		"https://EXAMPLE.com./path",
+		"https://a.example.org/",
+		"https://a.b.example.org/",
+		"https://xn--e1afmkfd.xn--p1ai.xn--e1afmkfd.xn--p1ai/",
+		"https://сайт.пример.рф/",
+	} {
+		require.NoError(t, policy.Check(raw), raw)
+	}
+
+	require.ErrorIs(t, policy.Check("https://www.example.com/"), urlpolicy.ErrDomainNotAllowed)
+	require.ErrorIs(t, policy.Check("https://example.org/"), urlpolicy.ErrDomainNotAllowed)
+	require.ErrorIs(t, policy.Check("https://notexample.com/"), urlpolicy.ErrDomainNotAllowed)
+	require.ErrorIs(t, policy.Check("https://bad.example.org/"), urlpolicy.ErrDomainDenied)
+}
+
+func TestNew_InvalidList(t *testing.T) {
+	_, err := urlpolicy.New(urlpolicy.Config{DenyList: writeList(t, "*.exa*mple.com\n")})
+	require.ErrorIs(t, err, urlpolicy.ErrInvalidEntry)
+
+	_, err = urlpolicy.New(urlpolicy.Config{DenyList: filepath.Join(t.TempDir(), "missing.txt")})
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestCheck_NilPolicy(t *testing.T) {
+	var policy *urlpolicy.Policy
+
+	require.NoError(t, policy.Check("javascript:alert(1)"))
+}
@@ -0,0 +1,246 @@
+// Package urlpolicy decides which destinations links may point to.
+//
+// Domain list files hold one entry per line, blank lines and lines starting with # are skipped.
+// "example.com" matches only that host, "*.example.com" matches every subdomain of it but not example.com itself.
+package urlpolicy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var (
+	ErrSchemeNotAllowed = errors.New("url scheme is not allowed")
+	ErrDomainDenied     = errors.New("destination domain is blocked")
+	ErrDomainNotAllowed = errors.New("destination domain is not allowed")
+	ErrPrivateAddress   = errors.New("destination is a private address")
+	ErrInvalidEntry     = errors.New("invalid domain list entry")
+)
+
+// DefaultSchemes are allowed when Config.Schemes is empty
+var DefaultSchemes = []string{"http", "https"}
+
+type Config struct {
+	Schemes   []string
+	AllowList string // path to a domain list file, empty allows every domain that is not denied
+	DenyList  string // path to a domain list file
+	// BlockPrivate rejects loopback, private, link-local and unspecified ip hosts and localhost
+	BlockPrivate bool
+}
+
+// Policy is safe for concurrent use, a nil Policy allows everything
+type Policy struct {
+	schemes      map[string]bool
+	allow        *domains // nil allows every domain
+	deny         *domains
+	blockPrivate bool
+}
+
+func New(cfg Config) (*Policy, error) {
+	const mark = "urlpolicy.New"
+
+	schemes := cfg.Schemes
+	if len(schemes) == 0 {
+		schemes = DefaultSchemes
+	}
+
+	p := &Policy{
+		schemes:      make(map[string]bool, len(schemes)),
+		deny:         &domains{},
+		blockPrivate: cfg.BlockPrivate,
+	}
+	for _, scheme := range schemes {
+		p.schemes[strings.ToLower(strings.TrimSpace(scheme))] = true
+	}
+
+	if cfg.AllowList != "" {
+		allow, err := loadDomains(cfg.AllowList)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%w", mark, err)
+		}
+		p.allow = allow
+	}
+
+	if cfg.DenyList != "" {
+		deny, err := loadDomains(cfg.DenyList)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%w", mark, err)
+		}
+		p.deny = deny
+	}
+
+	return p, nil
+}
+
+// Check reports why rawURL may not be a destination, the deny list wins over the allow list
+func (p *Policy) Check(rawURL string) error {
+	if p == nil {
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if !p.schemes[scheme] {
+		return fmt.Errorf("%w %q", ErrSchemeNotAllowed, scheme)
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		if p.allow != nil {
+			return ErrDomainNotAllowed
+		}
+		return nil
+	}
+
+	if p.blockPrivate && isPrivate(host) {
+		return fmt.Errorf("%w %q", ErrPrivateAddress, host)
+	}
+
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		host = ascii
+	}
+
+	if p.deny.match(host) {
+		return fmt.Errorf("%w %q", ErrDomainDenied, host)
+	}
+	if p.allow != nil && !p.allow.match(host) {
+		return fmt.Errorf("%w %q", ErrDomainNotAllowed, host)
+	}
+
+	return nil
+}
+
+// domains matches hosts against exact names and "*." wildcards
+type domains struct {
+	exact    map[string]bool
+	wildcard map[string]bool // parents whose subdomains match
+}
+
+func parseDomains(entries []string) (*domains, error) {
+	d := &domains{
+		exact:    make(map[string]bool),
+		wildcard: make(map[string]bool),
+	}
+
+	for _, entry := range entries {
+		name, wildcard := strings.CutPrefix(strings.ToLower(entry), "*.")
+		name = strings.TrimSuffix(name, ".")
+
+		ascii, err := idna.Lookup.ToASCII(name)
+		if err != nil || name == "" || strings.Contains(name, "*") {
+			return nil, fmt.Errorf("%w %q", ErrInvalidEntry, entry)
+		}
+
+		if wildcard {
+			d.wildcard[ascii] = true
+		} else {
+			d.exact[ascii] = true
+		}
+	}
+
+	return d, nil
+}
+
+func loadDomains(path string) (*domains, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	d, err := parseDomains(entries)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", path, err)
+	}
+
+	return d, nil
+}
+
+func (d *domains) match(host string) bool {
+	if d.exact[host] {
+		return true
+	}
+
+	for parent := host; ; {
+		_, rest, ok := strings.Cut(parent, ".")
+		if !ok {
+			return false
+		}
+		if d.wildcard[rest] {
+			return true
+		}
+		parent = rest
+	}
+}
+
+func isPrivate(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		ip = parseNumericIPv4(host)
+	}
+	if ip == nil {
+		return false
+	}
+
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast()
+}
+
+// parseNumericIPv4 reads the forms browsers still accept for ipv4 hosts,
+// like 2130706433, 0x7f.1 or 0177.0.0.1, so they can not sneak past the private address check
+func parseNumericIPv4(host string) net.IP {
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil
+	}
+
+	var ip uint64
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 0, 32)
+		if err != nil {
+			return nil
+		}
+
+		// the last part fills every byte left
+		bits := 8
+		if i == len(parts)-1 {
+			bits = 8 * (4 - i)
+		}
+		if n >= 1<<bits {
+			return nil
+		}
+		ip = ip<<bits | n
+	}
+
+	return net.IPv4(byte(ip>>24), byte(ip>>16), byte(ip>>8), byte(ip))
+}
@@ -0,0 +1,54 @@
+package utmtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FacelessWayfarer/urlshortner/internal/lib/utm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApply(t *testing.T) {
+	vars := utm.Vars{Alias: "spring", Now: time.Date(2024, 3, 1, 23, 30, 0, 0, time.FixedZone("", -2*60*60))}
+
+	cases := []struct {
+		url    string
+		params map[string]string
+		want   string
+	}{
+		{
+			url:  "https://example.com/",
+			want: "https://example.com/",
+		},
+		{
+			url:    "https://example.com/",
+			params: map[string]string{"utm_source": "newsletter", "utm_campaign": "{alias}-{date}"},
+			want:   "https://example.com/?utm_campaign=spring-2024-03-02&utm_source=newsletter",
+		},
+		{
+			url:    "https://example.com/shop?utm_source=site&id=7#top",
+			params: map[string]string{"utm_source": "newsletter", "utm_medium": "e mail"},
+			want:   "https://example.com/shop?utm_source=site&id=7&utm_medium=e+mail#top",
+		},
+	}
+
+	for _, tc := range cases {
+		got, err := utm.Apply(tc.url, tc.params, vars)
+		require.NoError(t, err, tc.url)
+		require.Equal(t, tc.want, got, tc.url)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	require.NoError(t, utm.Check(nil))
+	require.NoError(t, utm.Check(map[string]string{"utm_campaign": "{alias}_{date}", "ref": "plain"}))
+
+	require.ErrorIs(t, utm.Check(map[string]string{" ": "x"}), utm.ErrEmptyName)
+	require.ErrorIs(t, utm.Check(map[string]string{"utm_source": "{user}"}), utm.ErrUnknownPlaceholder)
+
+	tooMany := make(map[string]string, utm.MaxParams+1)
+	for i := range utm.MaxParams + 1 {
+		tooMany[string(rune('a'+i))] = "x"
+	}
+	require.ErrorIs(t, utm.Check(tooMany), utm.ErrTooManyParams)
+}
@@ -0,0 +1,87 @@
+// Package utm fills the query parameter templates of links on redirect, so campaign
+// parameters like utm_source are kept with the link instead of being typed into every destination.
+//
+// Values may use the placeholders {alias}, the alias that was visited, and {date}, the UTC date of the visit.
+package utm
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxParams is how many parameters a link may carry
+const MaxParams = 20
+
+var (
+	ErrEmptyName          = errors.New("parameter name is empty")
+	ErrTooManyParams      = errors.New("too many parameters")
+	ErrUnknownPlaceholder = errors.New("unknown placeholder")
+)
+
+var placeholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// Vars are the values placeholders are replaced with
+type Vars struct {
+	Alias string
+	Now   time.Time
+}
+
+// Check reports why params can not be saved with a link
+func Check(params map[string]string) error {
+	if len(params) > MaxParams {
+		return fmt.Errorf("%w: at most %d", ErrTooManyParams, MaxParams)
+	}
+
+	for name, value := range params {
+		if strings.TrimSpace(name) == "" {
+			return ErrEmptyName
+		}
+		for _, p := range placeholder.FindAllString(value, -1) {
+			if p != "{alias}" && p != "{date}" {
+				return fmt.Errorf("%w %s in %s", ErrUnknownPlaceholder, p, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Apply adds params with their placeholders filled to the query of rawURL, sorted by name.
+// Parameters rawURL already has keep their values.
+func Apply(rawURL string, params map[string]string, vars Vars) (string, error) {
+	if len(params) == 0 {
+		return rawURL, nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	existing := u.Query()
+	replacer := strings.NewReplacer("{alias}", vars.Alias, "{date}", vars.Now.UTC().Format(time.DateOnly))
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		if _, ok := existing[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names)+1)
+	if u.RawQuery != "" {
+		pairs = append(pairs, u.RawQuery)
+	}
+	for _, name := range names {
+		pairs = append(pairs, url.QueryEscape(name)+"="+url.QueryEscape(replacer.Replace(params[name])))
+	}
+	u.RawQuery = strings.Join(pairs, "&")
+
+	return u.String(), nil
+}
@@ -43,22 +43,26 @@ func TestURLShortner_SaveGet(t *testing.T) {
 		alias string
 		url   string
 		err   string
+		code  int // expected HTTP status of the save request
 	}{
 		{
 			name:  "Valid URL",
 			url:   gofakeit.URL(),
 			alias: gofakeit.Word() + gofakeit.Word(),
+			code:  http.StatusOK,
 		},
 		{
 			name:  "Invalid URL",
 			url:   "invalid_url",
 			alias: gofakeit.Word(),
 			err:   "field URL is not a valid URL",
+			code:  http.StatusBadRequest,
 		},
 		{
 			name:  "Empty Alias",
 			url:   gofakeit.URL(),
 			alias: "",
+			code:  http.StatusOK,
 		},
 	}
 	for _, tc := range testCases {
@@ -68,7 +72,7 @@ func TestURLShortner_SaveGet(t *testing.T) {
 			e := httpexpect.Default(t, u.String())
 
 			r := e.POST("/url").WithJSON(urlsave.Request{URL: tc.url, Alias: tc.alias}).
-				WithBasicAuth("CoolAdmin69", "6996").Expect().Status(http.StatusOK).JSON().Object()
+				WithBasicAuth("CoolAdmin69", "6996").Expect().Status(tc.code).JSON().Object()
 
 			if tc.err != "" {
 				r.NotContainsKey("alias")
@@ -88,8 +92,11 @@ func TestURLShortner_SaveGet(t *testing.T) {
 				alias = r.Value("alias").String().Raw()
 			}
 
-			testGet(t, alias, tc.url)
-			testGet(t, alias, tc.url)
+			// the url is stored in canonical form, which is what the redirect points to
+			canonical := r.Value("url").String().Raw()
+
+			testGet(t, alias, canonical)
+			testGet(t, alias, canonical)
 			_ = e.DELETE("/"+path.Join("url", alias)).WithBasicAuth("CoolAdmin69", "6996").WithHeader("Content-Type", "application/json").
 				Expect().Status(http.StatusOK)
 